@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var aliasCommand = &cli.Command{
+	Name:  "alias",
+	Usage: "manage the aliases (--alias) deploys were made under",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "list every alias of the site with its latest deploy",
+			Action: listAliases,
+		},
+		{
+			Name:      "delete",
+			Usage:     "delete every deploy made under an alias, which takes the alias url down",
+			ArgsUsage: "<alias>",
+			Action:    deleteAlias,
+		},
+	},
+}
+
+// maxAliasLabel is the longest dns label, which alias--site has to fit in
+const maxAliasLabel = 63
+
+var aliasUnsafe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugifyAlias turns a branch name into something netlify accepts as an
+// alias, lowercase letters, digits and single dashes, short enough that
+// alias--site is still a valid hostname
+func slugifyAlias(branch string, site string) string {
+	alias := strings.Trim(aliasUnsafe.ReplaceAllString(strings.ToLower(branch), "-"), "-")
+
+	if max := maxAliasLabel - len("--") - len(site); len(alias) > max && max > 0 {
+		alias = strings.TrimRight(alias[:max], "-")
+	}
+
+	return alias
+}
+
+// currentBranch is the branch being built, from the ci environment when
+// there is one as ci usually checks out a detached head
+func currentBranch() (string, error) {
+	for _, name := range []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME", "CI_COMMIT_REF_NAME", "BRANCH_NAME", "CIRCLE_BRANCH", "BRANCH"} {
+		if branch := os.Getenv(name); branch != "" {
+			return branch, nil
+		}
+	}
+
+	out, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to get the current git branch")
+	}
+
+	branch := strings.TrimSpace(string(out))
+	if branch == "HEAD" {
+		return "", fmt.Errorf("Unable to get the current git branch, HEAD is detached")
+	}
+
+	return branch, nil
+}
+
+// commitTitle is the subject and short sha of the HEAD commit, the way
+// netlify titles deploys of git connected sites
+func commitTitle() (string, error) {
+	out, err := exec.Command("git", "log", "-1", "--format=%s%x00%h").Output()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to read the latest git commit")
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(string(out)), "\x00", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("Unable to read the latest git commit")
+	}
+
+	return fmt.Sprintf("%s (%s)", parts[0], parts[1]), nil
+}
+
+// siteDeploys pages through every deploy of a site, newest first
+func (cfg *config) siteDeploys(siteID string) ([]*netlify.Deploy, error) {
+	page := int32(1)
+	perPage := int32(100)
+	deploys := []*netlify.Deploy{}
+
+	for {
+		resp, err := cfg.netlifyClient().Operations.ListSiteDeploys(
+			operations.NewListSiteDeploysParams().WithTimeout(cfg.APITimeout).WithSiteID(siteID).WithPage(&page).WithPerPage(&perPage),
+			authInfo(cfg.Token),
+		)
+		if err != nil {
+			return nil, errors.Wrap(classifyAPIError(err), "Unable to list deploys")
+		}
+
+		if len(resp.GetPayload()) == 0 {
+			return deploys, nil
+		}
+
+		deploys = append(deploys, resp.GetPayload()...)
+		page++
+	}
+}
+
+func aliasURL(site *netlify.Site, alias string) string {
+	return fmt.Sprintf("https://%s--%s.netlify.app", alias, site.Name)
+}
+
+func listAliases(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	deploys, err := cfg.siteDeploys(site.ID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tURL\tLATEST DEPLOY\tCREATED\tDEPLOYS")
+
+	counts := map[string]int{}
+	latest := []*netlify.Deploy{}
+	for _, deploy := range deploys {
+		if deploy.Branch == "" {
+			continue
+		}
+		if counts[deploy.Branch] == 0 {
+			latest = append(latest, deploy)
+		}
+		counts[deploy.Branch]++
+	}
+
+	for _, deploy := range latest {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\n", deploy.Branch, aliasURL(site, deploy.Branch), deploy.ID, deploy.CreatedAt, counts[deploy.Branch])
+	}
+
+	return w.Flush()
+}
+
+// deleteAlias removes an alias by deleting every deploy made under it, as
+// netlify has no way to drop just the alias. Deploys under the alias that are
+// published to production are kept.
+func deleteAlias(c *cli.Context) error {
+	alias := c.Args().First()
+	if alias == "" {
+		return fmt.Errorf("alias delete requires an alias")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	deploys, err := cfg.siteDeploys(site.ID)
+	if err != nil {
+		return err
+	}
+
+	deleted := 0
+	for _, deploy := range deploys {
+		if deploy.Branch != alias {
+			continue
+		}
+
+		if site.PublishedDeploy != nil && deploy.ID == site.PublishedDeploy.ID {
+			log.Printf("[WARN] Keeping deploy %s as it is published", deploy.ID)
+			continue
+		}
+
+		path := fmt.Sprintf("/sites/%s/deploys/%s", url.PathEscape(site.ID), url.PathEscape(deploy.ID))
+		if _, err := cfg.apiCall(http.MethodDelete, path, nil); err != nil {
+			return errors.Wrapf(err, "Unable to delete deploy %s", deploy.ID)
+		}
+		deleted++
+	}
+
+	if deleted == 0 {
+		return fmt.Errorf("No deploys found under alias %s", alias)
+	}
+
+	log.Printf("Deleted %d deploys under alias %s", deleted, alias)
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var apiCommand = &cli.Command{
+	Name:      "api",
+	Usage:     "call any netlify api operation and print the json it returns",
+	ArgsUsage: "<operation>",
+	Action:    callAPI,
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "param",
+			Usage: "key=value parameter for the operation, like site_id=abc, can be repeated",
+		},
+		&cli.StringFlag{
+			Name:  "data",
+			Usage: "Json request body for operations that take one",
+		},
+		&cli.BoolFlag{
+			Name:  "list",
+			Usage: "List the operations that can be called",
+		},
+	},
+}
+
+// apiOperations are the methods of the generated operations client, keyed by
+// their open-api operationId
+func apiOperations(client interface{}) map[string]reflect.Value {
+	operations := map[string]reflect.Value{}
+
+	value := reflect.ValueOf(client)
+	for i := 0; i < value.NumMethod(); i++ {
+		method := value.Type().Method(i)
+		if method.Type.NumIn() != 3 || method.Type.NumOut() != 2 {
+			// SetTransport and anything else that isn't an operation
+			continue
+		}
+
+		name := []rune(method.Name)
+		name[0] = unicode.ToLower(name[0])
+		operations[string(name)] = value.Method(i)
+	}
+
+	return operations
+}
+
+// normalizeParamName lets site_id, site-id and siteId all match SiteID
+func normalizeParamName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// setParam converts value to the type of a generated params field
+func setParam(field reflect.Value, value string) error {
+	target := field
+	if field.Kind() == reflect.Ptr {
+		target = reflect.New(field.Type().Elem()).Elem()
+	}
+
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(value)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		target.SetInt(i)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		target.SetBool(b)
+	default:
+		return fmt.Errorf("%s parameters aren't supported", field.Type())
+	}
+
+	if field.Kind() == reflect.Ptr {
+		field.Set(target.Addr())
+	} else {
+		field.Set(target)
+	}
+
+	return nil
+}
+
+// buildAPIParams fills a generated params struct from key=value pairs and a
+// json body. The body goes into the one field that isn't a plain value.
+func buildAPIParams(paramsType reflect.Type, timeout time.Duration, pairs []string, data string) (reflect.Value, error) {
+	params := reflect.New(paramsType.Elem())
+	params.MethodByName("SetTimeout").Call([]reflect.Value{reflect.ValueOf(timeout)})
+
+	fields := map[string]reflect.Value{}
+	var body reflect.Value
+	for i := 0; i < params.Elem().NumField(); i++ {
+		field := params.Elem().Type().Field(i)
+		if field.PkgPath != "" || field.Name == "Context" || field.Name == "HTTPClient" {
+			continue
+		}
+
+		kind := field.Type.Kind()
+		if kind == reflect.Ptr {
+			kind = field.Type.Elem().Kind()
+		}
+		if kind == reflect.Struct || kind == reflect.Slice || kind == reflect.Interface {
+			body = params.Elem().Field(i)
+			continue
+		}
+
+		fields[normalizeParamName(field.Name)] = params.Elem().Field(i)
+	}
+
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return params, fmt.Errorf("--param %s should be key=value", pair)
+		}
+
+		field, ok := fields[normalizeParamName(kv[0])]
+		if !ok {
+			return params, fmt.Errorf("Unknown parameter %s", kv[0])
+		}
+
+		if err := setParam(field, kv[1]); err != nil {
+			return params, errors.Wrapf(err, "Invalid value for %s", kv[0])
+		}
+	}
+
+	if data != "" {
+		if !body.IsValid() {
+			return params, fmt.Errorf("This operation doesn't take a body")
+		}
+
+		if body.Type() == reflect.TypeOf((*io.ReadCloser)(nil)).Elem() {
+			return params, fmt.Errorf("File uploads aren't supported, use deploy")
+		}
+
+		value := reflect.New(body.Type())
+		if err := json.Unmarshal([]byte(data), value.Interface()); err != nil {
+			return params, errors.Wrap(err, "Unable to parse --data")
+		}
+		body.Set(value.Elem())
+	}
+
+	return params, nil
+}
+
+// callAPI is an escape hatch for endpoints without a dedicated command
+func callAPI(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	operations := apiOperations(cfg.netlifyClient().Operations)
+
+	if c.Bool("list") {
+		names := []string{}
+		for name := range operations {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	}
+
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("api requires an operation, see --list")
+	}
+
+	operation, ok := operations[name]
+	if !ok {
+		for opName, op := range operations {
+			if strings.EqualFold(opName, name) {
+				operation, ok = op, true
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("Unknown operation %s, see --list", name)
+	}
+
+	params, err := buildAPIParams(operation.Type().In(0), cfg.APITimeout, c.StringSlice("param"), c.String("data"))
+	if err != nil {
+		return err
+	}
+
+	results := operation.Call([]reflect.Value{params, reflect.ValueOf(authInfo(cfg.Token))})
+	if err, _ := results[1].Interface().(error); err != nil {
+		return errors.Wrapf(classifyAPIError(err), "Unable to call %s", name)
+	}
+
+	getPayload := results[0].MethodByName("GetPayload")
+	if !getPayload.IsValid() {
+		// no content
+		return nil
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(getPayload.Call(nil)[0].Interface())
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+const projectName = "netlify-golang-deploy"
+
+// releaseArch mirrors the arch part of the archive name_template in .goreleaser.yaml
+func releaseArch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i386"
+	case "arm":
+		// goreleaser builds GOARM=6 unless told otherwise
+		return "armv6"
+	}
+
+	return goarch
+}
+
+// unameArch is what `uname -m` prints on a machine this binary is built for
+func unameArch(goarch string) string {
+	switch goarch {
+	case "amd64":
+		return "x86_64"
+	case "386":
+		return "i686"
+	case "arm64":
+		return "aarch64"
+	case "arm":
+		return "armv6l"
+	}
+
+	return goarch
+}
+
+func releaseArtifactName(release string, goos string, goarch string) string {
+	format := "tar.gz"
+	if goos == "windows" {
+		format = "zip"
+	}
+
+	return fmt.Sprintf("%s_%s_%s_%s.%s", projectName, strings.TrimPrefix(release, "v"), strings.Title(goos), releaseArch(goarch), format)
+}
+
+// archInfo prints which release artifact this binary came from, so install
+// scripts can check they downloaded the right one for the machine
+func archInfo(c *cli.Context) error {
+	fmt.Printf("os:\t%s\n", runtime.GOOS)
+	fmt.Printf("arch:\t%s\n", runtime.GOARCH)
+	fmt.Printf("uname:\t%s\n", unameArch(runtime.GOARCH))
+	fmt.Printf("artifact:\t%s\n", releaseArtifactName(version, runtime.GOOS, runtime.GOARCH))
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var buildHookCommand = &cli.Command{
+	Name:  "build-hook",
+	Usage: "manage and trigger the build hooks of a site",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "list the build hooks of the site",
+			Action: listBuildHooks,
+		},
+		{
+			Name:      "create",
+			Usage:     "create a new build hook",
+			ArgsUsage: "<title>",
+			Action:    createBuildHook,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "branch",
+					Usage: "Branch the hook should build",
+				},
+			},
+		},
+		{
+			Name:      "delete",
+			Usage:     "delete a build hook",
+			ArgsUsage: "<hook-id-or-name>",
+			Action:    deleteBuildHook,
+		},
+		{
+			Name:      "trigger",
+			Usage:     "kick off a build using a build hook",
+			ArgsUsage: "<hook-id-or-name>",
+			Action:    triggerBuildHook,
+		},
+	},
+}
+
+func (cfg *config) buildHooks(siteID string) ([]*netlify.BuildHook, error) {
+	hooks, err := cfg.netlifyClient().Operations.ListSiteBuildHooks(
+		operations.NewListSiteBuildHooksParams().WithTimeout(cfg.APITimeout).WithSiteID(siteID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to list build hooks")
+	}
+
+	return hooks.GetPayload(), nil
+}
+
+// findBuildHook matches a hook by id first and then by title
+func (cfg *config) findBuildHook(siteID string, idOrName string) (*netlify.BuildHook, error) {
+	hooks, err := cfg.buildHooks(siteID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range hooks {
+		if hook.ID == idOrName {
+			return hook, nil
+		}
+	}
+
+	for _, hook := range hooks {
+		if hook.Title == idOrName {
+			return hook, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No build hook found for %s", idOrName)
+}
+
+func listBuildHooks(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	hooks, err := cfg.buildHooks(site.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		fmt.Printf("%s\t%s\t%s\t%s\n", hook.ID, hook.Title, hook.Branch, hook.URL)
+	}
+
+	return nil
+}
+
+func createBuildHook(c *cli.Context) error {
+	title := c.Args().First()
+	if title == "" {
+		return fmt.Errorf("build-hook create requires a title")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	hook, err := cfg.netlifyClient().Operations.CreateSiteBuildHook(
+		operations.NewCreateSiteBuildHookParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID).WithBuildHook(&netlify.BuildHookSetup{
+			Title:  title,
+			Branch: c.String("branch"),
+		}),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to create build hook")
+	}
+
+	log.Printf("Created build hook %s - %s", hook.GetPayload().ID, hook.GetPayload().URL)
+
+	return nil
+}
+
+func deleteBuildHook(c *cli.Context) error {
+	idOrName := c.Args().First()
+	if idOrName == "" {
+		return fmt.Errorf("build-hook delete requires a hook id or name")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	hook, err := cfg.findBuildHook(site.ID, idOrName)
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.netlifyClient().Operations.DeleteSiteBuildHook(
+		operations.NewDeleteSiteBuildHookParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID).WithID(hook.ID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to delete build hook")
+	}
+
+	log.Printf("Deleted build hook %s", hook.ID)
+
+	return nil
+}
+
+// triggerBuildHook posts to the hook url, the same thing a git provider would do
+func triggerBuildHook(c *cli.Context) error {
+	idOrName := c.Args().First()
+	if idOrName == "" {
+		return fmt.Errorf("build-hook trigger requires a hook id or name")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	hook, err := cfg.findBuildHook(site.ID, idOrName)
+	if err != nil {
+		return err
+	}
+
+	ctx := cfg.ctx
+	if cfg.APITimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.APITimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, nil)
+	if err != nil {
+		return errors.Wrap(err, "Unable to trigger build hook")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Unable to trigger build hook")
+	}
+	defer resp.Body.Close()
+	// drained so the connection can be reused
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Unable to trigger build hook: %s", resp.Status)
+	}
+
+	log.Printf("Triggered build hook %s for %s", hook.Title, site.Name)
+
+	return nil
+}
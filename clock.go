@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"github.com/sethvargo/go-retry"
+)
+
+// clock is where the polling and retry loops get the time from and do their
+// sleeping, so tests can swap in a fake one and run the loops in milliseconds
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) Sleep(d time.Duration) {
+	time.Sleep(d)
+}
+
+// clockBackoff caps next at maxDuration and sleeps its delays on c, handing
+// go-retry a zero delay so none of the waiting happens on go-retry's own timers
+func clockBackoff(c clock, maxDuration time.Duration, next retry.Backoff) retry.Backoff {
+	start := c.Now()
+
+	return retry.BackoffFunc(func() (time.Duration, bool) {
+		remaining := maxDuration - c.Now().Sub(start)
+		if remaining <= 0 {
+			return 0, true
+		}
+
+		delay, stop := next.Next()
+		if stop {
+			return 0, true
+		}
+
+		if delay > remaining {
+			delay = remaining
+		}
+
+		c.Sleep(delay)
+		return 0, false
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+)
+
+// fakeClock only moves when something sleeps on it, and records the sleeps
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.sleeps = append(c.sleeps, d)
+}
+
+// redirectTransport sends every request to a test server, whatever host it
+// was made for
+type redirectTransport struct {
+	target *url.URL
+}
+
+func (t redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme = t.target.Scheme
+	req.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// testDeployConfig is a config talking to a server that reports a deploy in
+// each of states in turn, staying in the last one
+func testDeployConfig(t *testing.T, states ...string) (*config, *fakeClock) {
+	t.Helper()
+
+	var mu sync.Mutex
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		state := states[len(states)-1]
+		if polls < len(states) {
+			state = states[polls]
+		}
+		polls++
+		mu.Unlock()
+
+		json.NewEncoder(w).Encode(map[string]string{"id": "deploy", "state": state})
+	}))
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	return &config{
+		PollInterval:    time.Second,
+		PollMaxInterval: 8 * time.Second,
+		WaitTimeout:     time.Minute,
+		httpClient:      &http.Client{Transport: redirectTransport{target}},
+		clock:           clock,
+		// jitter always picks the top of its range, a nanosecond short of delay
+		random: func(n int64) int64 { return n - 1 },
+		ctx:    context.Background(),
+	}, clock
+}
+
+func TestGetDeployBacksOff(t *testing.T) {
+	cfg, clock := testDeployConfig(t, "uploading", "uploading", "uploading", "uploading", "uploading", "uploading", "processing", "ready")
+
+	deploy, err := cfg.getDeploy("deploy", "ready")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deploy.State != "ready" {
+		t.Fatalf("got %s, want ready", deploy.State)
+	}
+
+	// doubling up to the max, then back to the interval when the state changes
+	want := []time.Duration{1, 2, 4, 8, 8, 8, 1}
+	if len(clock.sleeps) != len(want) {
+		t.Fatalf("slept %v, want %d sleeps", clock.sleeps, len(want))
+	}
+	for i, seconds := range want {
+		if got, expected := clock.sleeps[i], seconds*time.Second-1; got != expected {
+			t.Errorf("sleep %d was %s, want %s", i, got, expected)
+		}
+	}
+}
+
+func TestGetDeployWaitTimeout(t *testing.T) {
+	cfg, clock := testDeployConfig(t, "processing")
+
+	_, err := cfg.getDeploy("deploy", "ready")
+	if !errors.Is(err, ErrWaitTimeout) {
+		t.Fatalf("got %v, want ErrWaitTimeout", err)
+	}
+
+	if waited := clock.Now().Sub(newFakeClock().Now()); waited < cfg.WaitTimeout || waited > cfg.WaitTimeout+cfg.PollMaxInterval {
+		t.Errorf("gave up after %s, want just over %s", waited, cfg.WaitTimeout)
+	}
+}
+
+func TestGetDeployFailed(t *testing.T) {
+	cfg, _ := testDeployConfig(t, "processing", "error")
+
+	if _, err := cfg.getDeploy("deploy", "ready"); !errors.Is(err, ErrDeployFailed) {
+		t.Fatalf("got %v, want ErrDeployFailed", err)
+	}
+}
+
+func TestClockBackoffStopsAtMaxDuration(t *testing.T) {
+	clock := newFakeClock()
+	backoff := clockBackoff(clock, 20*time.Second, retry.NewConstant(3*time.Second))
+
+	attempts := 0
+	err := retry.Do(context.Background(), backoff, func(ctx context.Context) error {
+		attempts++
+		return retry.RetryableError(errors.New("still failing"))
+	})
+	if err == nil {
+		t.Fatal("expected the last error once the budget ran out")
+	}
+
+	// attempts at 0s, 3s ... 18s, then the wait is cut to the 2s left for
+	// one last attempt at 20s
+	if attempts != 8 {
+		t.Errorf("made %d attempts, want 8", attempts)
+	}
+	if waited := clock.Now().Sub(newFakeClock().Now()); waited != 20*time.Second {
+		t.Errorf("waited %s, want 20s", waited)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// adaptive upload concurrency bounds, --queueSize auto starts at the minimum
+const (
+	adaptiveMinUploads = 2
+	adaptiveMaxUploads = 32
+)
+
+// adaptiveLimiter caps how many uploads run at once, adding one more each
+// time a full round of uploads succeeds and halving when netlify pushes back,
+// the same additive increase, multiplicative decrease tcp uses. A nil limiter
+// leaves concurrency to the fixed --queueSize.
+type adaptiveLimiter struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	limit     int
+	active    int
+	successes int
+}
+
+func newAdaptiveLimiter() *adaptiveLimiter {
+	l := &adaptiveLimiter{limit: adaptiveMinUploads}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *adaptiveLimiter) acquire() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+}
+
+func (l *adaptiveLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.cond.Broadcast()
+}
+
+func (l *adaptiveLimiter) succeeded() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.successes++
+	if l.successes >= l.limit && l.limit < adaptiveMaxUploads {
+		l.limit++
+		l.successes = 0
+		l.cond.Broadcast()
+	}
+}
+
+func (l *adaptiveLimiter) throttled() {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.successes = 0
+	if l.limit > adaptiveMinUploads {
+		l.limit /= 2
+		if l.limit < adaptiveMinUploads {
+			l.limit = adaptiveMinUploads
+		}
+		log.Printf("[DEBUG] netlify is pushing back, uploading %d files at a time", l.limit)
+	}
+}
+
+// isThrottled reports upload errors that mean netlify wants us to slow down
+func isThrottled(err error) bool {
+	if strings.Contains(err.Error(), "GOAWAY") {
+		return true
+	}
+
+	status := apiStatusCode(err)
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// isTimeout reports upload errors from an attempt running out of time, which
+// are worth another try. Callers check their own context first, a deploy
+// that's being cancelled shouldn't retry.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var daemonCommand = &cli.Command{
+	Name:   "daemon",
+	Usage:  "keep running and deploy on request, reusing site lookups and file hashes between deploys",
+	Action: runDaemon,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "Address to accept deploy requests on",
+			Value: "127.0.0.1:8765",
+		},
+		&cli.StringFlag{
+			Name:     "daemon-token",
+			Usage:    "Token every request has to send as an Authorization: Bearer header",
+			EnvVars:  []string{"NETLIFY_DAEMON_TOKEN"},
+			Required: true,
+		},
+	},
+}
+
+// daemonRecentDeploys is how many deploys GET /deploys remembers
+const daemonRecentDeploys = 20
+
+// daemonCache is what the daemon keeps between deploys, and a multi site
+// deploy shares between its pipelines, so each deploy skips the site lookup
+// and only re-hashes files that changed. A nil cache caches nothing.
+type daemonCache struct {
+	mu      sync.Mutex
+	sites   map[string]*netlify.Site
+	hashes  map[string]cachedHash
+	deploys []daemonDeploy
+}
+
+type cachedHash struct {
+	size    int64
+	modTime time.Time
+	sha     string
+}
+
+type daemonDeploy struct {
+	Site     string    `json:"site"`
+	DeployID string    `json:"deploy_id"`
+	URL      string    `json:"deploy_url"`
+	Started  time.Time `json:"started"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func newDaemonCache() *daemonCache {
+	return &daemonCache{
+		sites:   map[string]*netlify.Site{},
+		hashes:  map[string]cachedHash{},
+		deploys: []daemonDeploy{},
+	}
+}
+
+func (d *daemonCache) site(name string) *netlify.Site {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sites[name]
+}
+
+func (d *daemonCache) rememberSite(name string, site *netlify.Site) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sites[name] = site
+}
+
+// sha1 reuses the last hash of path unless its size or mtime changed
+func (d *daemonCache) sha1(path string, info os.FileInfo) (string, error) {
+	if d == nil {
+		return getSha1(path)
+	}
+
+	d.mu.Lock()
+	cached, ok := d.hashes[path]
+	d.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.sha, nil
+	}
+
+	sha, err := getSha1(path)
+	if err != nil {
+		return "", err
+	}
+
+	d.mu.Lock()
+	d.hashes[path] = cachedHash{size: info.Size(), modTime: info.ModTime(), sha: sha}
+	d.mu.Unlock()
+
+	return sha, nil
+}
+
+func (d *daemonCache) rememberDeploy(report *deployReport) {
+	deploy := daemonDeploy{
+		Site:     report.Site,
+		DeployID: report.DeployID,
+		URL:      report.DeployURL,
+		Started:  report.Started,
+	}
+	if report.Err != nil {
+		deploy.Error = report.Err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if report.Err != nil {
+		// the site may have been renamed or deleted, look it up again next time
+		delete(d.sites, report.Site)
+	}
+
+	d.deploys = append([]daemonDeploy{deploy}, d.deploys...)
+	if len(d.deploys) > daemonRecentDeploys {
+		d.deploys = d.deploys[:daemonRecentDeploys]
+	}
+}
+
+// daemonDeployRequest is the body of POST /deploy, anything left out comes
+// from the flags the daemon was started with
+type daemonDeployRequest struct {
+	SiteName  string `json:"siteName"`
+	DeployDir string `json:"deployDir"`
+	Alias     string `json:"alias"`
+	Title     string `json:"title"`
+	Message   string `json:"message"`
+	Draft     *bool  `json:"draft"`
+}
+
+// daemonResponse holds back the first event of a deploy, so one that fails
+// before getting anywhere (the site isn't found, deployDir can't be read) is
+// answered with an error status instead of a 200 carrying only the failed
+// result. Once a second event arrives the response streams, and a later
+// failure can only be reported in the result event and the Deploy-Error
+// trailer.
+type daemonResponse struct {
+	w       http.ResponseWriter
+	held    []byte
+	started bool
+}
+
+func (r *daemonResponse) Write(p []byte) (int, error) {
+	if !r.started && r.held == nil {
+		r.held = append([]byte{}, p...)
+		return len(p), nil
+	}
+
+	if !r.started {
+		r.start(http.StatusOK)
+	}
+
+	n, err := r.w.Write(p)
+	if flusher, ok := r.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
+
+func (r *daemonResponse) start(status int) {
+	r.started = true
+	r.w.Header().Set("Content-Type", "application/x-ndjson")
+	r.w.Header().Set("Trailer", "Deploy-Error")
+	r.w.WriteHeader(status)
+	r.w.Write(r.held)
+	r.held = nil
+}
+
+// finish sends anything still held back, with a status for err if the deploy
+// failed before streaming started
+func (r *daemonResponse) finish(err error) {
+	if !r.started {
+		r.start(daemonErrorStatus(err))
+	}
+
+	if err != nil {
+		r.w.Header().Set("Deploy-Error", strings.ReplaceAll(err.Error(), "\n", " "))
+	}
+}
+
+// daemonErrorStatus is the http status for a deploy's outcome
+func daemonErrorStatus(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrSiteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrUnauthorized):
+		// the daemon's own token was refused, not the caller's
+		return http.StatusBadGateway
+	}
+
+	return http.StatusInternalServerError
+}
+
+// daemonDeployDir resolves a requested deployDir, which has to be inside root,
+// the deployDir the daemon was started with. Relative paths are taken from
+// root and symlinks are followed before checking, so neither ../ nor a link
+// can reach the rest of the disk.
+func daemonDeployDir(root string, dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("deployDir %s is outside of %s", dir, root)
+	}
+
+	return resolved, nil
+}
+
+// daemonAuthorized reports if r carries the daemon's token
+func daemonAuthorized(r *http.Request, token string) bool {
+	sent := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(token)) == 1
+}
+
+// runDaemon serves POST /deploy, which deploys and streams the --output
+// ndjson events back, and GET /deploys, the most recent deploys. Deploys run
+// one at a time, and every request needs --daemon-token.
+func runDaemon(c *cli.Context) error {
+	base, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+	base.cache = newDaemonCache()
+
+	token := c.String("daemon-token")
+	if token == "" {
+		return fmt.Errorf("--daemon-token can't be empty")
+	}
+
+	var deploying sync.Mutex
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/deploy", func(w http.ResponseWriter, r *http.Request) {
+		if !daemonAuthorized(r, token) {
+			http.Error(w, "Missing or wrong token", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "POST a deploy request", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// a browser can't send json cross origin without a preflight, which
+		// this server never answers
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			http.Error(w, "Send the deploy request as application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		req := daemonDeployRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		cfg := base
+		if req.SiteName != "" {
+			cfg.Site = req.SiteName
+		}
+		if req.DeployDir != "" {
+			dir, err := daemonDeployDir(base.Directory, req.DeployDir)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			cfg.Directory = dir
+			cfg.Sources = nil
+		}
+		if req.Alias != "" {
+			cfg.Branch = req.Alias
+		}
+		if req.Title != "" {
+			cfg.Title = req.Title
+		}
+		if req.Message != "" {
+			cfg.Message = req.Message
+		}
+		if req.Draft != nil {
+			cfg.Draft = *req.Draft
+		}
+
+		resp := &daemonResponse{w: w}
+		cfg.events = &eventWriter{out: resp, clock: cfg.clock}
+
+		deploying.Lock()
+		defer deploying.Unlock()
+
+		report, err := cfg.deployAndReport()
+		cfg.cache.rememberDeploy(report)
+		resp.finish(err)
+	})
+
+	mux.HandleFunc("/deploys", func(w http.ResponseWriter, r *http.Request) {
+		if !daemonAuthorized(r, token) {
+			http.Error(w, "Missing or wrong token", http.StatusUnauthorized)
+			return
+		}
+
+		base.cache.mu.Lock()
+		defer base.cache.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(base.cache.deploys)
+	})
+
+	server := &http.Server{Addr: c.String("listen"), Handler: mux}
+	go func() {
+		<-c.Context.Done()
+		server.Close()
+	}()
+
+	log.Printf("Waiting for deploy requests on %s", c.String("listen"))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
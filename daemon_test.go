@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDaemonResponseEarlyFailure(t *testing.T) {
+	rec := httptest.NewRecorder()
+	resp := &daemonResponse{w: rec}
+
+	fmt.Fprintln(resp, `{"event":"result"}`)
+	resp.finish(fmt.Errorf("%w: example", ErrSiteNotFound))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if !strings.Contains(rec.Body.String(), `"result"`) {
+		t.Errorf("result event missing from %q", rec.Body.String())
+	}
+}
+
+func TestDaemonResponseStreamedFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resp := &daemonResponse{w: w}
+		fmt.Fprintln(resp, `{"event":"deploy_created"}`)
+		fmt.Fprintln(resp, `{"event":"result"}`)
+		resp.finish(fmt.Errorf("%w: example", ErrDeployFailed))
+	}))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want %d once events streamed", res.StatusCode, http.StatusOK)
+	}
+	if strings.Count(string(body), "\n") != 2 {
+		t.Errorf("got body %q, want both events", body)
+	}
+	if got := res.Trailer.Get("Deploy-Error"); !strings.Contains(got, "deploy failed") {
+		t.Errorf("got Deploy-Error trailer %q", got)
+	}
+}
+
+func TestDaemonResponseSuccess(t *testing.T) {
+	rec := httptest.NewRecorder()
+	resp := &daemonResponse{w: rec}
+
+	fmt.Fprintln(resp, `{"event":"result"}`)
+	resp.finish(nil)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
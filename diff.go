@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var diffCommand = &cli.Command{
+	Name:   "diff",
+	Usage:  "list what deploying deployDir would add, change and remove on the published site",
+	Action: diffDeploy,
+}
+
+var deploysCommand = &cli.Command{
+	Name:  "deploys",
+	Usage: "inspect existing deploys",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "diff",
+			Usage:     "list the paths added, changed and removed between two deploys",
+			ArgsUsage: "<deploy-id-a> <deploy-id-b>",
+			Action:    diffDeploys,
+		},
+	},
+}
+
+// fileChanges compares two path to sha maps, returning the sorted paths only
+// in to, in both with different content, and only in from
+func fileChanges(from map[string]string, to map[string]string) (added []string, changed []string, removed []string) {
+	for uri, sha := range to {
+		fromSha, ok := from[uri]
+		switch {
+		case !ok:
+			added = append(added, uri)
+		case fromSha != sha:
+			changed = append(changed, uri)
+		}
+	}
+
+	for uri := range from {
+		if _, ok := to[uri]; !ok {
+			removed = append(removed, uri)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(changed)
+	sort.Strings(removed)
+
+	return added, changed, removed
+}
+
+// printFileChanges prints one path per line, prefixed with + for added, ~ for
+// changed and - for removed
+func printFileChanges(from map[string]string, to map[string]string) {
+	added, changed, removed := fileChanges(from, to)
+
+	for _, uri := range added {
+		fmt.Printf("+ %s\n", uri)
+	}
+	for _, uri := range changed {
+		fmt.Printf("~ %s\n", uri)
+	}
+	for _, uri := range removed {
+		fmt.Printf("- %s\n", uri)
+	}
+
+	log.Printf("%d added, %d changed, %d removed", len(added), len(changed), len(removed))
+}
+
+// publishedFiles returns the path to sha map of the site's published deploy
+func (cfg *config) publishedFiles(siteID string) (map[string]string, error) {
+	files, err := cfg.netlifyClient().Operations.ListSiteFiles(
+		operations.NewListSiteFilesParams().WithTimeout(cfg.APITimeout).WithSiteID(siteID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to list the published files")
+	}
+
+	filenameToSha := map[string]string{}
+	for _, file := range files.GetPayload() {
+		filenameToSha[file.Path] = file.Sha
+	}
+
+	return filenameToSha, nil
+}
+
+// deployFiles returns the path to sha map of any deploy. The generated client
+// only lists the files of the published deploy, so this goes around it.
+func (cfg *config) deployFiles(deployID string) (map[string]string, error) {
+	files := []*netlify.File{}
+	if _, err := cfg.apiGet("/deploys/"+url.PathEscape(deployID)+"/files", &files); err != nil {
+		return nil, errors.Wrapf(err, "Unable to list the files of deploy %s", deployID)
+	}
+
+	filenameToSha := map[string]string{}
+	for _, file := range files {
+		filenameToSha[file.Path] = file.Sha
+	}
+
+	return filenameToSha, nil
+}
+
+// diffDeploy compares deployDir to what the site is serving right now, so a
+// deploy can be reviewed before it is made
+func diffDeploy(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	cleanup, err := cfg.prepareSource()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	live, err := cfg.publishedFiles(site.ID)
+	if err != nil {
+		return err
+	}
+
+	local, _, err := cfg.collectFiles()
+	if err != nil {
+		return err
+	}
+
+	printFileChanges(live, local)
+
+	return nil
+}
+
+// diffDeploys compares two existing deploys, what changed between one release
+// and the next
+func diffDeploys(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("deploys diff requires two deploy ids")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	from, err := cfg.deployFiles(c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+
+	to, err := cfg.deployFiles(c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	printFileChanges(from, to)
+
+	return nil
+}
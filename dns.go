@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var dnsRecordFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "type",
+		Usage:    "Record type (A, AAAA, CNAME, MX, TXT, NETLIFY, ...)",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:     "hostname",
+		Usage:    "Fully qualified hostname of the record",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:     "value",
+		Usage:    "Value of the record",
+		Required: true,
+	},
+	&cli.Int64Flag{
+		Name:  "ttl",
+		Usage: "Time to live in seconds",
+		Value: 3600,
+	},
+	&cli.Int64Flag{
+		Name:  "priority",
+		Usage: "Priority for MX and SRV records",
+	},
+}
+
+var dnsCommand = &cli.Command{
+	Name:  "dns",
+	Usage: "manage netlify dns zones and records",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "zones",
+			Usage:  "list dns zones",
+			Action: listDNSZones,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "account",
+					Usage: "Only list zones for this account slug",
+				},
+			},
+		},
+		{
+			Name:      "records",
+			Usage:     "list the records in a zone",
+			ArgsUsage: "<zone-id-or-domain>",
+			Action:    listDNSRecords,
+		},
+		{
+			Name:      "create",
+			Usage:     "create a record in a zone",
+			ArgsUsage: "<zone-id-or-domain>",
+			Action:    createDNSRecord,
+			Flags:     dnsRecordFlags,
+		},
+		{
+			Name:      "update",
+			Usage:     "replace a record in a zone",
+			ArgsUsage: "<zone-id-or-domain> <record-id>",
+			Action:    updateDNSRecord,
+			Flags:     dnsRecordFlags,
+		},
+		{
+			Name:      "delete",
+			Usage:     "delete a record from a zone",
+			ArgsUsage: "<zone-id-or-domain> <record-id>",
+			Action:    deleteDNSRecord,
+		},
+	},
+}
+
+func (cfg *config) dnsZones(accountSlug string) (netlify.DNSZones, error) {
+	params := operations.NewGetDNSZonesParams().WithTimeout(cfg.APITimeout)
+	if accountSlug != "" {
+		params = params.WithAccountSlug(&accountSlug)
+	}
+
+	zones, err := cfg.netlifyClient().Operations.GetDNSZones(params, authInfo(cfg.Token))
+	if err != nil {
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to list dns zones")
+	}
+
+	return zones.GetPayload(), nil
+}
+
+// findDNSZone accepts either the zone id or the domain it serves
+func (cfg *config) findDNSZone(idOrDomain string) (*netlify.DNSZone, error) {
+	zones, err := cfg.dnsZones("")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, zone := range zones {
+		if zone.ID == idOrDomain || zone.Name == idOrDomain {
+			return zone, nil
+		}
+	}
+
+	return nil, fmt.Errorf("No dns zone found for %s", idOrDomain)
+}
+
+func dnsRecordFromFlags(c *cli.Context) *netlify.DNSRecordCreate {
+	return &netlify.DNSRecordCreate{
+		Type:     c.String("type"),
+		Hostname: c.String("hostname"),
+		Value:    c.String("value"),
+		TTL:      c.Int64("ttl"),
+		Priority: c.Int64("priority"),
+	}
+}
+
+func (cfg *config) createDNSRecord(zone *netlify.DNSZone, setup *netlify.DNSRecordCreate) (*netlify.DNSRecord, error) {
+	record, err := cfg.netlifyClient().Operations.CreateDNSRecord(
+		operations.NewCreateDNSRecordParams().WithTimeout(cfg.APITimeout).WithZoneID(zone.ID).WithDNSRecord(setup),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to create dns record")
+	}
+
+	return record.GetPayload(), nil
+}
+
+func (cfg *config) getDNSRecord(zone *netlify.DNSZone, recordID string) (*netlify.DNSRecord, error) {
+	record, err := cfg.netlifyClient().Operations.GetIndividualDNSRecord(
+		operations.NewGetIndividualDNSRecordParams().WithTimeout(cfg.APITimeout).WithZoneID(zone.ID).WithDNSRecordID(recordID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return nil, errors.Wrapf(classifyAPIError(err), "Unable to get dns record %s", recordID)
+	}
+
+	return record.GetPayload(), nil
+}
+
+func (cfg *config) deleteDNSRecord(zone *netlify.DNSZone, recordID string) error {
+	_, err := cfg.netlifyClient().Operations.DeleteDNSRecord(
+		operations.NewDeleteDNSRecordParams().WithTimeout(cfg.APITimeout).WithZoneID(zone.ID).WithDNSRecordID(recordID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to delete dns record")
+	}
+
+	return nil
+}
+
+func listDNSZones(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	// --account is also a global flag, which this one hides when not given
+	account := cfg.Account
+	if !c.IsSet("account") {
+		account = rootContext(c).String("account")
+	}
+
+	zones, err := cfg.dnsZones(account)
+	if err != nil {
+		return err
+	}
+
+	for _, zone := range zones {
+		fmt.Printf("%s\t%s\t%s\n", zone.ID, zone.Name, zone.AccountSlug)
+	}
+
+	return nil
+}
+
+func listDNSRecords(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return fmt.Errorf("dns records requires a zone")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	zone, err := cfg.findDNSZone(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	records, err := cfg.netlifyClient().Operations.GetDNSRecords(
+		operations.NewGetDNSRecordsParams().WithTimeout(cfg.APITimeout).WithZoneID(zone.ID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to list dns records")
+	}
+
+	for _, record := range records.GetPayload() {
+		fmt.Printf("%s\t%s\t%s\t%s\t%d\n", record.ID, record.Type, record.Hostname, record.Value, record.TTL)
+	}
+
+	return nil
+}
+
+func createDNSRecord(c *cli.Context) error {
+	if c.Args().Len() < 1 {
+		return fmt.Errorf("dns create requires a zone")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	zone, err := cfg.findDNSZone(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	record, err := cfg.createDNSRecord(zone, dnsRecordFromFlags(c))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Created %s record %s for %s", record.Type, record.ID, record.Hostname)
+
+	return nil
+}
+
+// updateDNSRecord replaces the record, as the api has no update call
+func updateDNSRecord(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return fmt.Errorf("dns update requires a zone and a record id")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	zone, err := cfg.findDNSZone(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	old, err := cfg.getDNSRecord(zone, c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	record, err := cfg.replaceDNSRecord(zone, old, dnsRecordFromFlags(c))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Replaced record %s with %s record %s for %s", old.ID, record.Type, record.ID, record.Hostname)
+
+	return nil
+}
+
+// replaceDNSRecord swaps old for a record made from setup. Netlify refuses a
+// CNAME next to any other record for its hostname, and a second record of
+// the same type and hostname, so those go delete first, putting old back if
+// its replacement can't be made. Anything else is created before old goes,
+// so a failure never leaves the hostname without either.
+func (cfg *config) replaceDNSRecord(zone *netlify.DNSZone, old *netlify.DNSRecord, setup *netlify.DNSRecordCreate) (*netlify.DNSRecord, error) {
+	if !strings.EqualFold(old.Type, "CNAME") && !strings.EqualFold(setup.Type, "CNAME") && !strings.EqualFold(old.Type, setup.Type) {
+		record, err := cfg.createDNSRecord(zone, setup)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Old record %s is unchanged", old.ID)
+		}
+
+		if err := cfg.deleteDNSRecord(zone, old.ID); err != nil {
+			return nil, errors.Wrapf(err, "Created record %s but old record %s is still there, both are being served", record.ID, old.ID)
+		}
+
+		return record, nil
+	}
+
+	if err := cfg.deleteDNSRecord(zone, old.ID); err != nil {
+		return nil, errors.Wrapf(err, "Old record %s is unchanged", old.ID)
+	}
+
+	record, err := cfg.createDNSRecord(zone, setup)
+	if err == nil {
+		return record, nil
+	}
+
+	restored, restoreErr := cfg.createDNSRecord(zone, &netlify.DNSRecordCreate{
+		Type:     old.Type,
+		Hostname: old.Hostname,
+		Value:    old.Value,
+		TTL:      old.TTL,
+		Priority: old.Priority,
+		Flag:     old.Flag,
+		Tag:      old.Tag,
+	})
+	if restoreErr != nil {
+		return nil, fmt.Errorf("Deleted record %s but couldn't create its replacement (%w) or put it back (%v), %s has no %s record", old.ID, err, restoreErr, old.Hostname, old.Type)
+	}
+
+	return nil, errors.Wrapf(err, "Deleted record %s but couldn't create its replacement, put it back as record %s", old.ID, restored.ID)
+}
+
+func deleteDNSRecord(c *cli.Context) error {
+	if c.Args().Len() < 2 {
+		return fmt.Errorf("dns delete requires a zone and a record id")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	zone, err := cfg.findDNSZone(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	if err := cfg.deleteDNSRecord(zone, c.Args().Get(1)); err != nil {
+		return err
+	}
+
+	log.Printf("Deleted dns record %s", c.Args().Get(1))
+
+	return nil
+}
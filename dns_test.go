@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	netlify "github.com/netlify/open-api/go/models"
+)
+
+// testDNSConfig is a config talking to a dns api that answers each create
+// with the next of createStatuses, recording every call made
+func testDNSConfig(t *testing.T, createStatuses ...int) (*config, *[]string) {
+	t.Helper()
+
+	calls := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.Method)
+
+		switch r.Method {
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodPost:
+			status := createStatuses[0]
+			createStatuses = createStatuses[1:]
+			if status != http.StatusCreated {
+				w.WriteHeader(status)
+				return
+			}
+
+			var record netlify.DNSRecord
+			json.NewDecoder(r.Body).Decode(&record)
+			record.ID = "new-" + strings.ToLower(record.Type)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(record)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &config{
+		APITimeout: 5 * time.Second,
+		httpClient: &http.Client{Transport: redirectTransport{target}},
+		ctx:        context.Background(),
+	}, &calls
+}
+
+func TestReplaceDNSRecord(t *testing.T) {
+	zone := &netlify.DNSZone{ID: "zone"}
+	old := &netlify.DNSRecord{ID: "old", Type: "A", Hostname: "www.example.com", Value: "192.0.2.1", TTL: 3600}
+
+	tests := []struct {
+		name      string
+		newType   string
+		creates   []int
+		wantCalls string
+		wantErr   string
+	}{
+		{
+			name:      "another type is created first",
+			newType:   "AAAA",
+			creates:   []int{http.StatusCreated},
+			wantCalls: "POST DELETE",
+		},
+		{
+			name:      "the same type is deleted first",
+			newType:   "A",
+			creates:   []int{http.StatusCreated},
+			wantCalls: "DELETE POST",
+		},
+		{
+			name:      "a CNAME is deleted first",
+			newType:   "CNAME",
+			creates:   []int{http.StatusCreated},
+			wantCalls: "DELETE POST",
+		},
+		{
+			name:      "a failed replacement puts the old record back",
+			newType:   "A",
+			creates:   []int{http.StatusUnprocessableEntity, http.StatusCreated},
+			wantCalls: "DELETE POST POST",
+			wantErr:   "put it back as record new-a",
+		},
+		{
+			name:      "a failed restore says the record is gone",
+			newType:   "A",
+			creates:   []int{http.StatusUnprocessableEntity, http.StatusUnprocessableEntity},
+			wantCalls: "DELETE POST POST",
+			wantErr:   "www.example.com has no A record",
+		},
+		{
+			name:      "a failed create first leaves the old record alone",
+			newType:   "AAAA",
+			creates:   []int{http.StatusUnprocessableEntity},
+			wantCalls: "POST",
+			wantErr:   "Old record old is unchanged",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, calls := testDNSConfig(t, tt.creates...)
+
+			record, err := cfg.replaceDNSRecord(zone, old, &netlify.DNSRecordCreate{Type: tt.newType, Hostname: "www.example.com", Value: "example.net"})
+			if got := strings.Join(*calls, " "); got != tt.wantCalls {
+				t.Errorf("made calls %s, want %s", got, tt.wantCalls)
+			}
+
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if record.Type != tt.newType {
+					t.Errorf("got a %s record, want %s", record.Type, tt.newType)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want it to say %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli/v2"
+)
+
+// docsCommand is for packagers, who ship the man page with the deb and rpm
+var docsCommand = &cli.Command{
+	Name:   "docs",
+	Usage:  "generate documentation from the command definitions",
+	Hidden: true,
+	Subcommands: []*cli.Command{
+		{
+			Name:  "man",
+			Usage: "print a man page",
+			Action: func(c *cli.Context) error {
+				page, err := rootContext(c).App.ToMan()
+				if err != nil {
+					return err
+				}
+
+				fmt.Print(page)
+				return nil
+			},
+		},
+		{
+			Name:  "markdown",
+			Usage: "print markdown documentation",
+			Action: func(c *cli.Context) error {
+				page, err := rootContext(c).App.ToMarkdown()
+				if err != nil {
+					return err
+				}
+
+				fmt.Print(page)
+				return nil
+			},
+		},
+	},
+}
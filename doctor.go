@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// maxClockSkew is how far the local clock may drift from netlify's before
+// signed requests and token checks start to misbehave
+const maxClockSkew = time.Minute
+
+type doctorCheck struct {
+	name string
+	run  func() (string, error)
+}
+
+// doctor runs a set of environment checks and prints pass/fail for each, so
+// "deploys fail on this machine" reports can be triaged with one command.
+func doctor(c *cli.Context) error {
+	// a missing token is one of the checks, not a reason to stop
+	cfg, err := newAnonymousConfig(c)
+	if err != nil {
+		return err
+	}
+
+	var serverTime time.Time
+
+	checks := []doctorCheck{
+		{"proxy configuration", cfg.checkProxy},
+		{"api connectivity", func() (string, error) {
+			now, detail, err := cfg.checkConnectivity()
+			serverTime = now
+			return detail, err
+		}},
+		{"clock skew", func() (string, error) {
+			return checkClockSkew(serverTime)
+		}},
+		{"token", cfg.checkToken},
+		{"site access", cfg.checkSite},
+		{"file descriptor limit", func() (string, error) {
+			return checkFileLimit(cfg.QueueSize)
+		}},
+		{"deploy directory", cfg.checkDirectory},
+	}
+
+	failed := 0
+	for _, check := range checks {
+		detail, err := check.run()
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL\t%s: %v\n", check.name, err)
+			continue
+		}
+		fmt.Printf("PASS\t%s: %s\n", check.name, detail)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+
+	return nil
+}
+
+func (cfg *config) checkProxy() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, cfg.schemes()[0]+"://"+netlifyAPIHost+netlifyAPIPath, nil)
+	if err != nil {
+		return "", err
+	}
+
+	proxy, err := http.ProxyFromEnvironment(req)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid proxy environment")
+	}
+
+	if proxy == nil {
+		return "no proxy", nil
+	}
+
+	return "using " + proxy.Redacted(), nil
+}
+
+func (cfg *config) checkConnectivity() (time.Time, string, error) {
+	start := time.Now()
+
+	resp, err := cfg.httpClient.Get(cfg.schemes()[0] + "://" + netlifyAPIHost + netlifyAPIPath + "/")
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	resp.Body.Close()
+
+	serverTime, _ := http.ParseTime(resp.Header.Get("Date"))
+
+	return serverTime, fmt.Sprintf("%s reachable in %s", netlifyAPIHost, time.Since(start).Round(time.Millisecond)), nil
+}
+
+func checkClockSkew(serverTime time.Time) (string, error) {
+	if serverTime.IsZero() {
+		return "", fmt.Errorf("unable to read the server time")
+	}
+
+	skew := time.Since(serverTime).Round(time.Second)
+	if skew > maxClockSkew || skew < -maxClockSkew {
+		return "", fmt.Errorf("local clock is off by %s", skew)
+	}
+
+	return fmt.Sprintf("off by %s", skew), nil
+}
+
+func (cfg *config) checkToken() (string, error) {
+	if cfg.Token == "" {
+		return "", fmt.Errorf("no token set, pass --token or run login")
+	}
+
+	user, err := cfg.currentUser()
+	if err != nil {
+		return "", err
+	}
+
+	return "authenticated as " + user.Email, nil
+}
+
+// checkDirectory checks every deployDir has something in it to deploy
+func (cfg *config) checkDirectory() (string, error) {
+	checked := []string{}
+
+	for _, source := range cfg.sources() {
+		if source.dir == stdinDirectory {
+			checked = append(checked, "stdin")
+			continue
+		}
+
+		info, err := os.Stat(source.dir)
+		if err != nil {
+			return "", err
+		}
+
+		if !info.IsDir() {
+			if strings.EqualFold(filepath.Ext(source.dir), ".zip") {
+				checked = append(checked, source.dir)
+				continue
+			}
+			return "", fmt.Errorf("%s is not a directory", source.dir)
+		}
+
+		hasFile, err := hasRegularFile(source.dir)
+		if err != nil {
+			return "", err
+		}
+
+		if !hasFile {
+			return "", fmt.Errorf("%s has no files in it, has the site been built?", source.dir)
+		}
+
+		checked = append(checked, source.dir)
+	}
+
+	return strings.Join(checked, ", ") + " readable and not empty", nil
+}
+
+func (cfg *config) checkSite() (string, error) {
+	if cfg.Site == "" {
+		return "skipped, no siteName given", nil
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("found %s (%s) in %s", site.Name, site.ID, site.AccountSlug), nil
+}
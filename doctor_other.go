@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package main
+
+import "runtime"
+
+// the rlimit field types differ between the bsds, so there's no portable check
+func checkFileLimit(queueSize int) (string, error) {
+	return "not checked on " + runtime.GOOS, nil
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// minFileLimit leaves room for the upload workers plus the hashing walk
+const minFileLimit = 256
+
+func checkFileLimit(queueSize int) (string, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return "", err
+	}
+
+	if limit.Cur < minFileLimit || limit.Cur < uint64(queueSize)*4 {
+		return "", fmt.Errorf("open file limit is %d, raise it with ulimit -n", limit.Cur)
+	}
+
+	return fmt.Sprintf("%d open files allowed", limit.Cur), nil
+}
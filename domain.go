@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var domainCommand = &cli.Command{
+	Name:  "domain",
+	Usage: "manage the custom domains of a site",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "add",
+			Usage:     "attach a custom domain to the site",
+			ArgsUsage: "<domain>",
+			Action:    addDomain,
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{
+					Name:  "alias",
+					Usage: "Extra domain alias to attach as well, can be repeated",
+				},
+			},
+		},
+	},
+}
+
+// addDomain makes the domain the primary custom domain if the site doesn't
+// have one yet, otherwise it is added as a domain alias.
+func addDomain(c *cli.Context) error {
+	domain := c.Args().First()
+	if domain == "" {
+		return fmt.Errorf("domain add requires a domain")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	setup := &netlify.SiteSetup{}
+	setup.DomainAliases = site.DomainAliases
+
+	newAliases := c.StringSlice("alias")
+	if site.CustomDomain == "" {
+		setup.CustomDomain = domain
+	} else if site.CustomDomain != domain {
+		newAliases = append([]string{domain}, newAliases...)
+	}
+
+	for _, alias := range newAliases {
+		if !containsString(setup.DomainAliases, alias) {
+			setup.DomainAliases = append(setup.DomainAliases, alias)
+		}
+	}
+
+	updated, err := cfg.netlifyClient().Operations.UpdateSite(
+		operations.NewUpdateSiteParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID).WithSite(setup),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to add domain")
+	}
+
+	log.Printf("Added %s to %s", domain, updated.GetPayload().Name)
+
+	return cfg.reportDomainStatus(updated.GetPayload(), append([]string{domain}, c.StringSlice("alias")...))
+}
+
+// reportDomainStatus prints whether each domain is served by netlify dns or
+// already points at the site, so callers know if more dns work is needed.
+func (cfg *config) reportDomainStatus(site *netlify.Site, domains []string) error {
+	zones, err := cfg.netlifyClient().Operations.GetDNSForSite(
+		operations.NewGetDNSForSiteParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to get dns for site")
+	}
+
+	netlifyDomain := site.Name + ".netlify.app."
+
+	for _, domain := range domains {
+		status := "not pointing at netlify yet"
+
+		for _, zone := range zones.GetPayload() {
+			if domain == zone.Name || strings.HasSuffix(domain, "."+zone.Name) {
+				status = "managed by netlify dns"
+			}
+		}
+
+		if cname, err := net.LookupCNAME(domain); err == nil && cname == netlifyDomain {
+			status = "verified, points at " + strings.TrimSuffix(netlifyDomain, ".")
+		}
+
+		fmt.Printf("%s\t%s\n", domain, status)
+	}
+
+	return nil
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+
+	return false
+}
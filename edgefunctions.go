@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// edgeFunctionsURLPath is where netlify expects the edge function bundles and
+// their manifest inside a deploy
+const edgeFunctionsURLPath = "/.netlify/internal/edge-functions"
+
+type edgeFunctionsManifest struct {
+	Functions []struct {
+		Function string `json:"function"`
+		Path     string `json:"path"`
+	} `json:"functions"`
+}
+
+// addEdgeFunctions adds already bundled edge functions (the manifest.json and
+// bundles the netlify edge bundler writes) to the deploy. Nothing happens if
+// dir has no manifest.
+func addEdgeFunctions(dir string, filenameToSha map[string]string, shaToFilename map[string][]*shaData) error {
+	contents, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Unable to read edge functions manifest")
+	}
+
+	manifest := edgeFunctionsManifest{}
+	if err := json.Unmarshal(contents, &manifest); err != nil {
+		return errors.Wrap(err, "Unable to parse edge functions manifest")
+	}
+
+	edgeFilenameToSha, edgeShaToFilename, err := filesInDirectory(dir, 1, nil)
+	if err != nil {
+		return errors.Wrap(err, "Unable to walk edge functions directory")
+	}
+
+	for uri, sha := range edgeFilenameToSha {
+		filenameToSha[edgeFunctionsURLPath+uri] = sha
+	}
+
+	for sha, files := range edgeShaToFilename {
+		for _, data := range files {
+			shaToFilename[sha] = append(shaToFilename[sha], &shaData{
+				realfilename: data.realfilename,
+				uri:          edgeFunctionsURLPath + data.uri,
+			})
+		}
+	}
+
+	log.Printf("Including %d edge functions from %s", len(manifest.Functions), dir)
+
+	return nil
+}
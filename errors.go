@@ -0,0 +1,82 @@
+package main
+
+import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-openapi/runtime"
+)
+
+var (
+	// ErrSiteNotFound is returned when no site matches the requested name
+	ErrSiteNotFound = stderrors.New("site not found")
+	// ErrUnauthorized is returned when netlify rejects the access token
+	ErrUnauthorized = stderrors.New("unauthorized")
+	// ErrDeployFailed is returned when netlify reports the deploy as errored
+	ErrDeployFailed = stderrors.New("deploy failed")
+	// ErrWaitTimeout is returned when a deploy doesn't reach the wanted state in time
+	ErrWaitTimeout = stderrors.New("timed out waiting for deploy")
+	// ErrUploadFailed is returned when netlify still needs files after every retry
+	ErrUploadFailed = stderrors.New("upload failed")
+)
+
+// Exit codes for each class of failure, so scripts can tell them apart
+// without reading the logs. Anything else exits with exitFailure, and 2 is
+// skipped as shells and flag parsers use it for usage errors.
+const (
+	exitFailure      = 1
+	exitUnauthorized = 3
+	exitSiteNotFound = 4
+	exitUploadFailed = 5
+	exitDeployFailed = 6
+	exitWaitTimeout  = 7
+)
+
+// exitCode picks the exit code for an error returned by a command
+func exitCode(err error) int {
+	switch {
+	case stderrors.Is(err, ErrUnauthorized):
+		return exitUnauthorized
+	case stderrors.Is(err, ErrSiteNotFound):
+		return exitSiteNotFound
+	case stderrors.Is(err, ErrUploadFailed):
+		return exitUploadFailed
+	case stderrors.Is(err, ErrDeployFailed):
+		return exitDeployFailed
+	case stderrors.Is(err, ErrWaitTimeout):
+		return exitWaitTimeout
+	}
+
+	return exitFailure
+}
+
+// apiStatusCode pulls the http status out of the errors the generated client returns
+func apiStatusCode(err error) int {
+	var apiErr *runtime.APIError
+	if stderrors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+
+	var coder interface{ Code() int }
+	if stderrors.As(err, &coder) {
+		return coder.Code()
+	}
+
+	return 0
+}
+
+// classifyAPIError wraps err with ErrUnauthorized when netlify rejected the
+// credentials, so callers can use errors.Is instead of matching strings.
+func classifyAPIError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch apiStatusCode(err) {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// esbuild bundles entry and everything it imports into one commonjs file for
+// netlify's node runtime, leaving externals to be required at runtime. It runs
+// the esbuild executable, a single static binary, so no node install is
+// needed to package functions. esbuild's own errors are what the returned
+// error carries, rather than only its exit status.
+func (cfg *config) esbuild(entry string, output string, externals []string) error {
+	args := []string{entry, "--bundle", "--platform=node", "--target=node18", "--format=cjs", "--log-level=warning", "--color=false", "--outfile=" + output}
+	for _, external := range externals {
+		args = append(args, "--external:"+external)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(cfg.ctx, cfg.ESBuild, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+
+	log.Printf("Bundling %s with esbuild", entry)
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("node_bundler esbuild needs the esbuild binary, install it or point --esbuild at it")
+		}
+		if messages := esbuildErrors(stderr.String()); len(messages) > 0 {
+			return errors.Wrapf(fmt.Errorf("%s", strings.Join(messages, "; ")), "Unable to bundle %s", entry)
+		}
+		return errors.Wrapf(err, "Unable to bundle %s", entry)
+	}
+
+	return nil
+}
+
+// esbuildErrors picks the error messages out of esbuild's log, each one a
+// "[ERROR] message" line followed by the source location it points at
+func esbuildErrors(output string) []string {
+	messages := []string{}
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		start := strings.Index(line, "[ERROR] ")
+		if start < 0 {
+			continue
+		}
+
+		message := strings.TrimSpace(line[start+len("[ERROR] "):])
+		// the location is on the next non blank line, like "    src/api.ts:3:7:"
+		for _, next := range lines[i+1:] {
+			if next = strings.TrimSpace(next); next != "" {
+				if strings.HasSuffix(next, ":") {
+					message = strings.TrimSuffix(next, ":") + ": " + message
+				}
+				break
+			}
+		}
+		messages = append(messages, message)
+	}
+
+	return messages
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEsbuildErrors(t *testing.T) {
+	output := `✘ [ERROR] Could not resolve "left-pad"
+
+    netlify/functions/api.ts:1:20:
+      1 │ import leftPad from "left-pad"
+        ╵                     ~~~~~~~~~~
+
+  You can mark the path "left-pad" as external to exclude it from the bundle.
+
+▲ [WARNING] "import.meta" is not available in the configured target environment
+
+✘ [ERROR] Expected ";" but found "}"
+
+    netlify/functions/api.ts:4:0:
+      4 │ }
+        ╵ ^
+
+2 errors
+`
+
+	want := []string{
+		`netlify/functions/api.ts:1:20: Could not resolve "left-pad"`,
+		`netlify/functions/api.ts:4:0: Expected ";" but found "}"`,
+	}
+	if got := esbuildErrors(output); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
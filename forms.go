@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var formsCommand = &cli.Command{
+	Name:  "forms",
+	Usage: "read netlify forms data",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "list the forms of the site",
+			Action: listForms,
+		},
+		{
+			Name:   "submissions",
+			Usage:  "export every submission of a form",
+			Action: exportFormSubmissions,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "form",
+					Usage:    "Id of the form to export",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "Output format, csv or json",
+					Value: "csv",
+				},
+			},
+		},
+	},
+}
+
+func listForms(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	forms, err := cfg.netlifyClient().Operations.ListSiteForms(
+		operations.NewListSiteFormsParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to list forms")
+	}
+
+	for _, form := range forms.GetPayload() {
+		fmt.Printf("%s\t%s\t%d\n", form.ID, form.Name, form.SubmissionCount)
+	}
+
+	return nil
+}
+
+func (cfg *config) formSubmissions(formID string) ([]*netlify.Submission, error) {
+	page := int32(1)
+	perPage := int32(100)
+	submissions := []*netlify.Submission{}
+
+	for {
+		resp, err := cfg.netlifyClient().Operations.ListFormSubmissions(
+			operations.NewListFormSubmissionsParams().WithTimeout(cfg.APITimeout).WithFormID(formID).WithPage(&page).WithPerPage(&perPage),
+			authInfo(cfg.Token),
+		)
+		if err != nil {
+			return nil, errors.Wrap(classifyAPIError(err), "Unable to list form submissions")
+		}
+
+		if len(resp.GetPayload()) == 0 {
+			return submissions, nil
+		}
+
+		submissions = append(submissions, resp.GetPayload()...)
+		page++
+	}
+}
+
+func exportFormSubmissions(c *cli.Context) error {
+	format := c.String("format")
+	if format != "csv" && format != "json" {
+		return fmt.Errorf("Unknown format %s, expected csv or json", format)
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	submissions, err := cfg.formSubmissions(c.String("form"))
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(submissions)
+	}
+
+	return writeSubmissionsCSV(submissions)
+}
+
+// writeSubmissionsCSV writes one row per submission, with a column for every
+// field that appears in any submission's data
+func writeSubmissionsCSV(submissions []*netlify.Submission) error {
+	fieldSet := map[string]bool{}
+	for _, submission := range submissions {
+		if data, ok := submission.Data.(map[string]interface{}); ok {
+			for field := range data {
+				fieldSet[field] = true
+			}
+		}
+	}
+
+	fields := make([]string, 0, len(fieldSet))
+	for field := range fieldSet {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	w := csv.NewWriter(os.Stdout)
+
+	header := append([]string{"id", "number", "created_at", "email", "name"}, fields...)
+	if err := w.Write(header); err != nil {
+		return err
+	}
+
+	for _, submission := range submissions {
+		row := []string{submission.ID, fmt.Sprint(submission.Number), submission.CreatedAt, submission.Email, submission.Name}
+
+		data, _ := submission.Data.(map[string]interface{})
+		for _, field := range fields {
+			value := ""
+			if v, ok := data[field]; ok && v != nil {
+				value = fmt.Sprint(v)
+			}
+			row = append(row, value)
+		}
+
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// framework is a static site generator recognised by the files it leaves in
+// a project, and where it writes the built site
+type framework struct {
+	name       string
+	markers    []string
+	publishDir string
+}
+
+// frameworks are checked in order, so the ones built on top of others (next
+// projects can have a vite config too) come first
+var frameworks = []framework{
+	{name: "Next.js export", markers: []string{"next.config.js", "next.config.mjs", "next.config.ts"}, publishDir: "out"},
+	{name: "Vite", markers: []string{"vite.config.js", "vite.config.mjs", "vite.config.ts"}, publishDir: "dist"},
+	{name: "Hugo", markers: []string{"hugo.toml", "hugo.yaml", "hugo.json"}, publishDir: "public"},
+	{name: "Jekyll", markers: []string{"_config.yml", "_config.yaml"}, publishDir: "_site"},
+}
+
+// detectFramework looks for a known framework in dir, for picking deployDir
+// when it isn't given
+func detectFramework(dir string) (framework, bool) {
+	for _, f := range frameworks {
+		for _, marker := range f.markers {
+			if _, err := os.Stat(filepath.Join(dir, marker)); err == nil {
+				return f, true
+			}
+		}
+	}
+
+	return framework{}, false
+}
@@ -0,0 +1,637 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/sethvargo/go-retry"
+)
+
+// functionRuntimeJS is the runtime netlify runs node functions with
+const functionRuntimeJS = "js"
+
+// functionBundle is a function packaged the way netlify takes it, a zip
+// identified by its sha256
+type functionBundle struct {
+	name    string
+	runtime string
+	sum     string
+	zip     []byte
+	// schedule is the cron expression for a scheduled function
+	schedule string
+}
+
+// functionConfig is a function's settings from netlify.toml
+type functionConfig struct {
+	includedFiles       []string
+	externalNodeModules []string
+	nodeBundler         string
+	schedule            string
+}
+
+// functionConfig merges [functions] with every [functions."pattern"] table
+// whose pattern matches name, more specific tables winning
+func (c netlifyConfig) functionConfig(name string) functionConfig {
+	tables := []string{}
+	for table := range c {
+		if pattern := strings.TrimPrefix(table, "functions."); pattern != table {
+			if ok, _ := path.Match(pattern, name); ok {
+				tables = append(tables, table)
+			}
+		}
+	}
+	// wildcard patterns first so a table for just this function wins
+	sort.Slice(tables, func(i, j int) bool {
+		iWild, jWild := strings.ContainsAny(tables[i], "*?["), strings.ContainsAny(tables[j], "*?[")
+		if iWild != jWild {
+			return iWild
+		}
+		return tables[i] < tables[j]
+	})
+	tables = append([]string{"functions"}, tables...)
+
+	config := functionConfig{}
+	for _, table := range tables {
+		if files := c.stringsValue(table, "included_files"); files != nil {
+			config.includedFiles = files
+		}
+		if modules := c.stringsValue(table, "external_node_modules"); modules != nil {
+			config.externalNodeModules = modules
+		}
+		if bundler := c.stringValue(table, "node_bundler"); bundler != "" {
+			config.nodeBundler = bundler
+		}
+		if schedule := c.stringValue(table, "schedule"); schedule != "" && table != "functions" {
+			config.schedule = schedule
+		}
+	}
+
+	return config
+}
+
+// functionsDir is --functions-dir, or where netlify.toml says the functions
+// are
+func (cfg *config) functionsDir(netlifyToml netlifyConfig) string {
+	if cfg.FunctionsDir != "" {
+		return cfg.FunctionsDir
+	}
+
+	if dir := netlifyToml.stringValue("functions", "directory"); dir != "" {
+		return filepath.Join(cfg.BuildDir, dir)
+	}
+	if dir := netlifyToml.stringValue("build", "functions"); dir != "" {
+		return filepath.Join(cfg.BuildDir, dir)
+	}
+
+	return ""
+}
+
+// bundleFunctions packages every function in the functions directory. Each
+// one is a .js or .ts file, a directory with an entry file of the same name or
+// index, a directory of Go sources, or a .zip that is deployed as it is.
+func (cfg *config) bundleFunctions() (map[string]*functionBundle, error) {
+	baseDir := filepath.Join(".", cfg.BuildDir)
+	netlifyToml, err := readNetlifyConfig(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dir := cfg.functionsDir(netlifyToml)
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) && cfg.FunctionsDir == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read the functions directory")
+	}
+
+	bundles := map[string]*functionBundle{}
+	for _, entry := range entries {
+		filename := filepath.Join(dir, entry.Name())
+		ext := filepath.Ext(entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ext)
+
+		var bundle *functionBundle
+		switch {
+		case strings.HasPrefix(entry.Name(), "."):
+			continue
+		case ext == ".zip":
+			bundle, err = zipFunctionBundle(name, filename, netlifyToml.functionConfig(name))
+		case entry.IsDir() && isGoFunction(filename):
+			if !cfg.GoFunctions {
+				log.Printf("[WARN] Skipping %s, it is a Go function and --go-functions isn't set to build it", filename)
+				continue
+			}
+			bundle, err = cfg.bundleGoFunction(entry.Name(), filename, netlifyToml.functionConfig(entry.Name()))
+		case entry.IsDir():
+			bundle, err = cfg.bundleNodeFunction(baseDir, entry.Name(), filename, netlifyToml.functionConfig(entry.Name()))
+		case isNodeEntry(ext):
+			bundle, err = cfg.bundleNodeFunction(baseDir, name, filename, netlifyToml.functionConfig(name))
+		default:
+			log.Printf("[WARN] Skipping %s, it isn't a function netlify-deploy knows how to package", filename)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to package function %s", name)
+		}
+		if bundle == nil {
+			continue
+		}
+
+		if _, ok := bundles[bundle.name]; ok {
+			return nil, fmt.Errorf("There is more than one function called %s in %s", bundle.name, dir)
+		}
+		bundles[bundle.name] = bundle
+	}
+
+	if len(bundles) > 0 {
+		log.Printf("Packaged %d functions from %s", len(bundles), dir)
+	}
+
+	return bundles, nil
+}
+
+func zipFunctionBundle(name string, filename string, config functionConfig) (*functionBundle, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := newFunctionBundle(name, functionRuntimeJS, contents)
+	bundle.schedule = config.schedule
+	return bundle, bundle.checkSchedule()
+}
+
+func newFunctionBundle(name string, runtime string, contents []byte) *functionBundle {
+	return &functionBundle{
+		name:    name,
+		runtime: runtime,
+		sum:     fmt.Sprintf("%x", sha256.Sum256(contents)),
+		zip:     contents,
+	}
+}
+
+// nodeEntryExtensions are the entry files a node function can have, the
+// typescript ones only when node_bundler is esbuild
+var nodeEntryExtensions = []string{".js", ".mjs", ".cjs", ".ts", ".mts", ".cts"}
+
+func isNodeEntry(ext string) bool {
+	for _, entryExt := range nodeEntryExtensions {
+		if ext == entryExt {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isTypeScript(filename string) bool {
+	switch filepath.Ext(filename) {
+	case ".ts", ".mts", ".cts":
+		return true
+	}
+
+	return false
+}
+
+// bundleNodeFunction zips a node function, as it is or bundled into a single
+// file by esbuild when node_bundler is esbuild. The entry file goes at the
+// root of the zip, included_files and external_node_modules keep their paths
+// relative to baseDir.
+func (cfg *config) bundleNodeFunction(baseDir string, name string, source string, config functionConfig) (*functionBundle, error) {
+	bundled := false
+	switch config.nodeBundler {
+	case "", "zisi", "none":
+	case "esbuild":
+		bundled = true
+	default:
+		return nil, fmt.Errorf("node_bundler %s isn't supported", config.nodeBundler)
+	}
+
+	files := map[string]string{}
+	generated := map[string]string{}
+	entryFile := source
+	entry := ""
+
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		for _, base := range []string{name, "index"} {
+			for _, ext := range nodeEntryExtensions {
+				if _, err := os.Stat(filepath.Join(source, base+ext)); err == nil && entry == "" {
+					entry = base + ext
+				}
+			}
+		}
+		if entry == "" {
+			log.Printf("[WARN] Skipping %s, it has no %s.js or index.js", source, name)
+			return nil, nil
+		}
+
+		entryFile = filepath.Join(source, entry)
+	}
+
+	if isTypeScript(entryFile) && !bundled {
+		return nil, fmt.Errorf("%s is typescript, set node_bundler = \"esbuild\" in netlify.toml to bundle it", entryFile)
+	}
+
+	switch {
+	case bundled:
+		out, err := os.MkdirTemp("", "netlify-deploy-function-")
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(out)
+
+		output := filepath.Join(out, name+".js")
+		if err := cfg.esbuild(entryFile, output, config.externalNodeModules); err != nil {
+			return nil, err
+		}
+		files[name+".js"] = output
+
+	case info.IsDir():
+		if err := addTreeToZip(files, source, ""); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(entry, name+".") {
+			// netlify looks for the handler in a file named after the function
+			generated[name+".js"] = fmt.Sprintf("module.exports = require('./%s')\n", entry)
+		}
+
+	default:
+		files[name+filepath.Ext(source)] = source
+	}
+
+	included, err := globFiles(baseDir, config.includedFiles)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range included {
+		files[rel] = filepath.Join(baseDir, filepath.FromSlash(rel))
+	}
+
+	for _, module := range config.externalNodeModules {
+		dir := filepath.Join(baseDir, "node_modules", filepath.FromSlash(module))
+		if err := addTreeToZip(files, dir, "node_modules/"+module); err != nil {
+			return nil, errors.Wrapf(err, "Unable to include node module %s", module)
+		}
+	}
+
+	contents, err := writeFunctionZip(files, generated)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := newFunctionBundle(name, functionRuntimeJS, contents)
+	bundle.schedule = config.schedule
+	if bundle.schedule == "" {
+		if bundle.schedule, err = sourceSchedule(entryFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return bundle, bundle.checkSchedule()
+}
+
+// sourceSchedules finds the schedule a function declares in its source,
+// either wrapped with schedule("@daily", handler) from @netlify/functions or
+// exported as config = { schedule: "@daily" }
+var sourceSchedules = []*regexp.Regexp{
+	regexp.MustCompile("\\bschedule\\(\\s*[\"'`]([^\"'`]+)[\"'`]"),
+	regexp.MustCompile("\\bschedule\\s*:\\s*[\"'`]([^\"'`]+)[\"'`]"),
+}
+
+func sourceSchedule(filename string) (string, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	for _, pattern := range sourceSchedules {
+		if match := pattern.FindSubmatch(contents); match != nil {
+			return string(match[1]), nil
+		}
+	}
+
+	return "", nil
+}
+
+// cronNicknames are the @ shorthands netlify accepts for a schedule
+var cronNicknames = map[string]bool{
+	"@yearly": true, "@annually": true, "@monthly": true, "@weekly": true, "@daily": true, "@hourly": true,
+}
+
+// checkSchedule catches schedules netlify would reject, which it only does
+// once the deploy is processed
+func (b *functionBundle) checkSchedule() error {
+	switch {
+	case b.schedule == "":
+		return nil
+	case strings.HasPrefix(b.schedule, "@"):
+		if !cronNicknames[b.schedule] {
+			return fmt.Errorf("function %s has schedule %s, which isn't one of @yearly, @monthly, @weekly, @daily or @hourly", b.name, b.schedule)
+		}
+	case len(strings.Fields(b.schedule)) != 5:
+		return fmt.Errorf("function %s has schedule %s, which isn't a five field cron expression", b.name, b.schedule)
+	}
+
+	return nil
+}
+
+// functionSchedule is an entry of a deploy's function_schedules
+type functionSchedule struct {
+	Name string `json:"name"`
+	Cron string `json:"cron"`
+}
+
+func functionSchedules(bundles map[string]*functionBundle) []functionSchedule {
+	schedules := []functionSchedule{}
+	for name, bundle := range bundles {
+		if bundle.schedule != "" {
+			schedules = append(schedules, functionSchedule{Name: name, Cron: bundle.schedule})
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].Name < schedules[j].Name })
+
+	return schedules
+}
+
+// addTreeToZip adds every file under dir to files, zip path to real path
+func addTreeToZip(files map[string]string, dir string, prefix string) error {
+	return filepath.Walk(dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filename)
+		if err != nil {
+			return err
+		}
+		files[path.Join(prefix, filepath.ToSlash(rel))] = filename
+		return nil
+	})
+}
+
+// writeFunctionZip zips files (zip path to real path) and generated (zip path
+// to contents) in a stable order with no timestamps, so the same function
+// always has the same sha and isn't uploaded again. Executables stay
+// executable.
+func writeFunctionZip(files map[string]string, generated map[string]string) ([]byte, error) {
+	names := make([]string, 0, len(files)+len(generated))
+	for zipPath := range files {
+		names = append(names, zipPath)
+	}
+	for zipPath := range generated {
+		if _, ok := files[zipPath]; !ok {
+			names = append(names, zipPath)
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, zipPath := range names {
+		header := &zip.FileHeader{Name: zipPath, Method: zip.Deflate}
+		if _, ok := generated[zipPath]; !ok {
+			if info, err := os.Stat(files[zipPath]); err == nil && info.Mode()&0111 != 0 {
+				header.SetMode(0755)
+			}
+		}
+
+		w, err := archive.CreateHeader(header)
+		if err != nil {
+			return nil, err
+		}
+
+		if contents, ok := generated[zipPath]; ok {
+			if _, err := io.WriteString(w, contents); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		f, err := os.Open(files[zipPath])
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(w, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// globFiles lists the files under baseDir matching patterns, relative and
+// slash separated. ** matches any number of directories and a pattern
+// starting with ! takes away what earlier ones matched.
+func globFiles(baseDir string, patterns []string) ([]string, error) {
+	matched := map[string]bool{}
+
+	for _, pattern := range patterns {
+		exclude := strings.HasPrefix(pattern, "!")
+		pattern = path.Clean(strings.TrimPrefix(strings.TrimPrefix(pattern, "!"), "./"))
+
+		if exclude {
+			for rel := range matched {
+				if matchPathGlob(pattern, rel) {
+					delete(matched, rel)
+				}
+			}
+			continue
+		}
+
+		// only walk below the part of the pattern without wildcards
+		root := pattern
+		for strings.ContainsAny(root, "*?[") {
+			root = path.Dir(root)
+		}
+
+		err := filepath.Walk(filepath.Join(baseDir, filepath.FromSlash(root)), func(filename string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			rel, err := filepath.Rel(baseDir, filename)
+			if err != nil {
+				return err
+			}
+			if rel = filepath.ToSlash(rel); rel == root || matchPathGlob(pattern, rel) {
+				matched[rel] = true
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	files := make([]string, 0, len(matched))
+	for rel := range matched {
+		files = append(files, rel)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// matchPathGlob is path.Match where a ** segment matches any number of
+// directories
+func matchPathGlob(pattern string, name string) bool {
+	patternParts := strings.Split(pattern, "/")
+	nameParts := strings.Split(name, "/")
+
+	var match func(p int, n int) bool
+	match = func(p int, n int) bool {
+		if p == len(patternParts) {
+			return n == len(nameParts)
+		}
+		if patternParts[p] == "**" {
+			for skip := n; skip <= len(nameParts); skip++ {
+				if match(p+1, skip) {
+					return true
+				}
+			}
+			return false
+		}
+		if n == len(nameParts) {
+			return false
+		}
+		if ok, _ := path.Match(patternParts[p], nameParts[n]); !ok {
+			return false
+		}
+		return match(p+1, n+1)
+	}
+
+	return match(0, 0)
+}
+
+// functionSums is the name to sha256 map the deploy is created with
+func functionSums(bundles map[string]*functionBundle) map[string]string {
+	if len(bundles) == 0 {
+		return nil
+	}
+
+	sums := map[string]string{}
+	for name, bundle := range bundles {
+		sums[name] = bundle.sum
+	}
+
+	return sums
+}
+
+// uploadFunctions uploads the functions netlify doesn't have yet, retrying
+// like file uploads do
+func (cfg *config) uploadFunctions(deployID string, required []string, bundles map[string]*functionBundle) error {
+	if len(required) == 0 {
+		return nil
+	}
+
+	log.Printf("Netlify already has %d of %d functions; uploading %d functions", len(bundles)-len(required), len(bundles), len(required))
+
+	auth := authInfo(cfg.Token)
+	for _, name := range required {
+		bundle, ok := bundles[name]
+		if !ok {
+			return fmt.Errorf("netlify needs function %s for deploy %s, which isn't in the functions directory", name, deployID)
+		}
+
+		backoff := retry.WithJitterPercent(uploadRetryJitter, retry.NewFibonacci(5*time.Second))
+		backoff = clockBackoff(cfg.clock, uploadRetryBudget(int64(len(bundle.zip)), cfg.UploadMinSpeed), backoff)
+
+		err := retry.Do(cfg.ctx, backoff, func(ctx context.Context) error {
+			size := int64(len(bundle.zip))
+			// the runtime ignores a params timeout once the params carry a
+			// context, so the deadline goes on the context
+			callCtx, cancel := context.WithTimeout(ctx, uploadTimeout(size, cfg.UploadMinSpeed, cfg.APITimeout))
+			defer cancel()
+			params := operations.NewUploadDeployFunctionParams().
+				WithContext(callCtx).
+				WithDeployID(deployID).
+				WithName(bundle.name).
+				WithRuntime(&bundle.runtime).
+				WithSize(&size).
+				WithFileBody(io.NopCloser(bytes.NewReader(bundle.zip)))
+
+			_, err := cfg.netlifyClient().Operations.UploadDeployFunction(params, auth)
+			if err != nil && (isThrottled(err) || ctx.Err() == nil && isTimeout(err)) {
+				return retry.RetryableError(err)
+			}
+			return err
+		})
+		if err != nil {
+			return errors.Wrapf(classifyAPIError(err), "Unable to upload function %s", name)
+		}
+
+		log.Printf("Uploaded function %s", name)
+	}
+
+	return nil
+}
+
+// createScheduledDeploy creates a deploy with function_schedules, which the
+// generated client's DeployFiles doesn't have
+func (cfg *config) createScheduledDeploy(siteID string, filenameToSha map[string]string, functions map[string]*functionBundle, schedules []functionSchedule) (*netlify.Deploy, error) {
+	for _, schedule := range schedules {
+		log.Printf("Scheduling function %s at %s", schedule.Name, schedule.Cron)
+	}
+
+	payload := struct {
+		Async             bool               `json:"async"`
+		Branch            string             `json:"branch,omitempty"`
+		Draft             bool               `json:"draft,omitempty"`
+		Files             map[string]string  `json:"files"`
+		Functions         map[string]string  `json:"functions"`
+		FunctionSchedules []functionSchedule `json:"function_schedules"`
+	}{
+		Async:             true,
+		Branch:            cfg.Branch,
+		Draft:             cfg.Draft,
+		Files:             filenameToSha,
+		Functions:         functionSums(functions),
+		FunctionSchedules: schedules,
+	}
+
+	deploy := &netlify.Deploy{}
+	path := "/sites/" + url.PathEscape(siteID) + "/deploys?title=" + url.QueryEscape(cfg.Title)
+	if _, err := cfg.apiSend(http.MethodPost, path, payload, deploy); err != nil {
+		return nil, err
+	}
+
+	return deploy, nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// previewComment is what gets posted on a pull or merge request. The marker
+// lets later deploys of the same site find and update it instead of adding
+// another comment.
+func previewComment(report *deployReport) (marker string, body string) {
+	marker = fmt.Sprintf("<!-- netlify-deploy:%s -->", report.Site)
+
+	if report.Err != nil {
+		return marker, fmt.Sprintf("%s\n:x: Deploy preview of **%s** failed after %s\n\n```\n%v\n```",
+			marker, report.Site, report.Duration.Round(time.Second), report.Err)
+	}
+
+	body = fmt.Sprintf("%s\n:white_check_mark: Deploy preview of **%s** is ready\n\n%s",
+		marker, report.Site, report.DeployURL)
+	if report.Message != "" {
+		body += "\n\n" + report.Message
+	}
+
+	return marker, body
+}
+
+var githubPullRef = regexp.MustCompile(`^refs/pull/(\d+)/`)
+
+// githubPullRequest works out which pull request an actions run is for, from
+// the event payload or failing that the ref
+func githubPullRequest() (int, error) {
+	if eventPath := os.Getenv("GITHUB_EVENT_PATH"); eventPath != "" {
+		contents, err := os.ReadFile(eventPath)
+		if err != nil {
+			return 0, errors.Wrap(err, "Unable to read the github event")
+		}
+
+		event := struct {
+			PullRequest struct {
+				Number int `json:"number"`
+			} `json:"pull_request"`
+		}{}
+		if err := json.Unmarshal(contents, &event); err != nil {
+			return 0, errors.Wrap(err, "Unable to parse the github event")
+		}
+
+		if event.PullRequest.Number != 0 {
+			return event.PullRequest.Number, nil
+		}
+	}
+
+	if match := githubPullRef.FindStringSubmatch(os.Getenv("GITHUB_REF")); match != nil {
+		return strconv.Atoi(match[1])
+	}
+
+	return 0, fmt.Errorf("not running for a pull request")
+}
+
+// commentRequest sends and decodes json for the code host integrations
+func (cfg *config) commentRequest(method string, url string, header http.Header, payload interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		return err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned %s", method, url, resp.Status)
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+
+	return nil
+}
+
+// commentOnGitHub posts the deploy preview url on the pull request the
+// actions run is for, updating the comment an earlier run left if there is one
+func (cfg *config) commentOnGitHub(report *deployReport) error {
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		return fmt.Errorf("GITHUB_TOKEN is not set")
+	}
+
+	repository := os.Getenv("GITHUB_REPOSITORY")
+	if repository == "" {
+		return fmt.Errorf("GITHUB_REPOSITORY is not set")
+	}
+
+	number, err := githubPullRequest()
+	if err != nil {
+		return err
+	}
+
+	apiURL := os.Getenv("GITHUB_API_URL")
+	if apiURL == "" {
+		apiURL = "https://api.github.com"
+	}
+	commentsURL := fmt.Sprintf("%s/repos/%s/issues/%d/comments", strings.TrimSuffix(apiURL, "/"), repository, number)
+
+	marker, body := previewComment(report)
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	header.Set("Authorization", "Bearer "+os.Getenv("GITHUB_TOKEN"))
+
+	comments := []struct {
+		URL  string `json:"url"`
+		Body string `json:"body"`
+	}{}
+	if err := cfg.commentRequest(http.MethodGet, commentsURL+"?per_page=100", header, nil, &comments); err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		if strings.HasPrefix(comment.Body, marker) {
+			return cfg.commentRequest(http.MethodPatch, comment.URL, header, map[string]string{"body": body}, nil)
+		}
+	}
+
+	return cfg.commentRequest(http.MethodPost, commentsURL, header, map[string]string{"body": body}, nil)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// commentOnGitLab adds the deploy preview url as a note on the merge request
+// a pipeline is for, updating the note an earlier pipeline left if there is
+// one. CI_JOB_TOKEN can't write notes, so GITLAB_TOKEN has to be a project or
+// personal access token with the api scope.
+func (cfg *config) commentOnGitLab(report *deployReport) error {
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return fmt.Errorf("GITLAB_TOKEN is not set")
+	}
+
+	mergeRequest := os.Getenv("CI_MERGE_REQUEST_IID")
+	if mergeRequest == "" {
+		return fmt.Errorf("not running in a merge request pipeline")
+	}
+
+	apiURL := os.Getenv("CI_API_V4_URL")
+	if apiURL == "" {
+		apiURL = "https://gitlab.com/api/v4"
+	}
+	notesURL := fmt.Sprintf("%s/projects/%s/merge_requests/%s/notes",
+		strings.TrimSuffix(apiURL, "/"), url.PathEscape(os.Getenv("CI_PROJECT_ID")), mergeRequest)
+
+	marker, body := previewComment(report)
+	header := http.Header{}
+	header.Set("PRIVATE-TOKEN", token)
+
+	notes := []struct {
+		ID   int    `json:"id"`
+		Body string `json:"body"`
+	}{}
+	if err := cfg.commentRequest(http.MethodGet, notesURL+"?per_page=100", header, nil, &notes); err != nil {
+		return err
+	}
+
+	for _, note := range notes {
+		if strings.HasPrefix(note.Body, marker) {
+			return cfg.commentRequest(http.MethodPut, fmt.Sprintf("%s/%d", notesURL, note.ID), header, map[string]string{"body": body}, nil)
+		}
+	}
+
+	return cfg.commentRequest(http.MethodPost, notesURL, header, map[string]string{"body": body}, nil)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// functionRuntimeGo is the runtime netlify runs go function binaries with
+const functionRuntimeGo = "go"
+
+// isGoFunction reports if a function directory is Go sources rather than
+// node, a directory with .go files
+func isGoFunction(dir string) bool {
+	matches, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	return len(matches) > 0
+}
+
+// bundleGoFunction cross compiles the main package in dir for netlify's
+// functions runtime, linux on amd64, and zips the binary under the
+// function's name
+func (cfg *config) bundleGoFunction(name string, dir string, config functionConfig) (*functionBundle, error) {
+	out, err := os.MkdirTemp("", "netlify-deploy-function-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(out)
+
+	binary := filepath.Join(out, name)
+	cmd := exec.CommandContext(cfg.ctx, "go", "build", "-trimpath", "-ldflags", "-s -w", "-o", binary, ".")
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "GOOS=linux", "GOARCH=amd64", "CGO_ENABLED=0")
+
+	log.Printf("Building Go function %s", name)
+	if err := cmd.Run(); err != nil {
+		return nil, errors.Wrapf(err, "Unable to build Go function %s", name)
+	}
+
+	contents, err := writeFunctionZip(map[string]string{name: binary}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := newFunctionBundle(name, functionRuntimeGo, contents)
+	bundle.schedule = config.schedule
+	return bundle, bundle.checkSchedule()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// runHook runs a --build-cmd, --pre-hook or --post-hook command through the
+// shell in dir (ours when empty) with the deploy's details added to its
+// environment. Its output goes straight to ours.
+func (cfg *config) runHook(name string, command string, dir string, env map[string]string) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(cfg.ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(cfg.ctx, "sh", "-c", command)
+	}
+
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+
+	log.Printf("Running %s: %s", name, command)
+	if err := cmd.Run(); err != nil {
+		return errors.Wrapf(err, "%s failed", name)
+	}
+
+	return nil
+}
+
+// parseBuildEnv turns --build-env KEY=VALUE pairs into a map
+func parseBuildEnv(pairs []string) (map[string]string, error) {
+	env := map[string]string{}
+	for _, pair := range pairs {
+		i := strings.Index(pair, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("--build-env %s is not KEY=VALUE", pair)
+		}
+		env[pair[:i]] = pair[i+1:]
+	}
+
+	return env, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// keyringService and keyringUser name the token's entry in the system keyring
+const (
+	keyringService = "netlify-deploy"
+	keyringUser    = "token"
+)
+
+// token sources for --token-source, where login stores the token and where
+// it is read from when --token isn't given
+const (
+	tokenSourceFile    = "file"
+	tokenSourceKeyring = "keyring"
+)
+
+// keychainSetCommand stores token in the macOS keychain. security only takes
+// the password as an argument, where any local user could read it with ps,
+// so the command is fed to security's interactive mode on stdin instead. It
+// lives outside keyring_darwin.go so it is tested everywhere.
+func keychainSetCommand(token string) *exec.Cmd {
+	quoted := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(token)
+
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w \"%s\"\n", keyringService, keyringUser, quoted))
+	return cmd
+}
+
+func checkTokenSource(source string) error {
+	if source != tokenSourceFile && source != tokenSourceKeyring {
+		return fmt.Errorf("Unknown token source %s, expected %s or %s", source, tokenSourceFile, tokenSourceKeyring)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+//go:build darwin
+// +build darwin
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// the macOS keychain through the security tool that ships with the os
+
+func keyringGet() (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", keyringService, "-a", keyringUser, "-w").Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+		// errSecItemNotFound
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func keyringSet(token string) error {
+	return keychainSetCommand(token).Run()
+}
+
+func keyringDelete() error {
+	err := exec.Command("security", "delete-generic-password", "-s", keyringService, "-a", keyringUser).Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 44 {
+		return nil
+	}
+
+	return err
+}
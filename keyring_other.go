@@ -0,0 +1,38 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// the freedesktop secret service (gnome keyring, kwallet) through secret-tool
+// from libsecret
+
+func keyringGet() (string, error) {
+	out, err := exec.Command("secret-tool", "lookup", "service", keyringService, "account", keyringUser).Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(out) == 0 {
+		// secret-tool exits 1 with no output when nothing matches
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(out)), nil
+}
+
+func keyringSet(token string) error {
+	cmd := exec.Command("secret-tool", "store", "--label=netlify deploy token", "service", keyringService, "account", keyringUser)
+	cmd.Stdin = strings.NewReader(token)
+
+	return cmd.Run()
+}
+
+func keyringDelete() error {
+	return exec.Command("secret-tool", "clear", "service", keyringService, "account", keyringUser).Run()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestKeychainSetCommandKeepsTokenOffArgv(t *testing.T) {
+	token := `secret-"token"\x`
+	cmd := keychainSetCommand(token)
+
+	for _, arg := range cmd.Args {
+		if strings.Contains(arg, "secret") {
+			t.Fatalf("token is in the command's arguments: %q", cmd.Args)
+		}
+	}
+
+	stdin, err := io.ReadAll(cmd.Stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `-w "secret-\"token\"\\x"`; !strings.Contains(string(stdin), want) {
+		t.Errorf("stdin %q doesn't pass the quoted token %s", stdin, want)
+	}
+}
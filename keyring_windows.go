@@ -0,0 +1,89 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// the windows credential manager through advapi32
+
+var (
+	advapi32       = syscall.NewLazyDLL("advapi32.dll")
+	procCredReadW  = advapi32.NewProc("CredReadW")
+	procCredWriteW = advapi32.NewProc("CredWriteW")
+	procCredDelete = advapi32.NewProc("CredDeleteW")
+	procCredFree   = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	errorNotFound           = syscall.Errno(1168)
+)
+
+// credential is CREDENTIALW
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+func keyringTarget() *uint16 {
+	target, _ := syscall.UTF16PtrFromString(keyringService + ":" + keyringUser)
+	return target
+}
+
+func keyringGet() (string, error) {
+	var cred *credential
+	r, _, err := procCredReadW.Call(uintptr(unsafe.Pointer(keyringTarget())), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if err == errorNotFound {
+			return "", nil
+		}
+		return "", err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+
+	return string(unsafe.Slice(cred.CredentialBlob, cred.CredentialBlobSize)), nil
+}
+
+func keyringSet(token string) error {
+	blob := []byte(token)
+	user, _ := syscall.UTF16PtrFromString(keyringUser)
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         keyringTarget(),
+		CredentialBlobSize: uint32(len(blob)),
+		CredentialBlob:     &blob[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           user,
+	}
+
+	r, _, err := procCredWriteW.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if r == 0 {
+		return err
+	}
+
+	return nil
+}
+
+func keyringDelete() error {
+	r, _, err := procCredDelete.Call(uintptr(unsafe.Pointer(keyringTarget())), credTypeGeneric, 0)
+	if r == 0 && err != errorNotFound {
+		return err
+	}
+
+	return nil
+}
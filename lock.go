@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// lockDeploy pins the site to the given deploy, stopping auto publishing
+func lockDeploy(c *cli.Context) error {
+	deployID := c.Args().First()
+	if deployID == "" {
+		return fmt.Errorf("lock requires a deploy id")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	locked, err := cfg.netlifyClient().Operations.LockDeploy(
+		operations.NewLockDeployParams().WithTimeout(cfg.APITimeout).WithDeployID(deployID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to lock deploy")
+	}
+
+	log.Printf("Deploy %s is locked", locked.GetPayload().ID)
+
+	return nil
+}
+
+// unlockDeploy releases a lock so new deploys get auto published again
+func unlockDeploy(c *cli.Context) error {
+	deployID := c.Args().First()
+	if deployID == "" {
+		return fmt.Errorf("unlock requires a deploy id")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	unlocked, err := cfg.netlifyClient().Operations.UnlockDeploy(
+		operations.NewUnlockDeployParams().WithTimeout(cfg.APITimeout).WithDeployID(deployID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to unlock deploy")
+	}
+
+	log.Printf("Deploy %s is unlocked", unlocked.GetPayload().ID)
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var loginCommand = &cli.Command{
+	Name:   "login",
+	Usage:  "authorize with netlify in a browser and store the access token for later deploys",
+	Action: login,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:     "client-id",
+			Usage:    "Client id of the netlify oauth application to log in with",
+			EnvVars:  []string{"NETLIFY_OAUTH_CLIENT_ID"},
+			Required: true,
+		},
+		&cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "How long to wait for the browser authorization",
+			Value: 5 * time.Minute,
+		},
+	},
+}
+
+var logoutCommand = &cli.Command{
+	Name:   "logout",
+	Usage:  "forget the access token stored by login",
+	Action: logout,
+}
+
+// storedTokenPath is where login keeps the access token
+func storedTokenPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to find the config directory")
+	}
+
+	return filepath.Join(dir, "netlify-deploy", "token"), nil
+}
+
+// readStoredToken returns the token saved by login, or "" if there isn't one
+func readStoredToken(source string) (string, error) {
+	if source == tokenSourceKeyring {
+		token, err := keyringGet()
+		if err != nil {
+			return "", errors.Wrap(err, "Unable to read the token from the keyring")
+		}
+		return token, nil
+	}
+
+	path, err := storedTokenPath()
+	if err != nil {
+		return "", err
+	}
+
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to read the stored token")
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// writeStoredToken saves the token and returns where it went
+func writeStoredToken(source string, token string) (string, error) {
+	if source == tokenSourceKeyring {
+		if err := keyringSet(token); err != nil {
+			return "", errors.Wrap(err, "Unable to store the token in the keyring")
+		}
+		return "the system keyring", nil
+	}
+
+	path, err := storedTokenPath()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", errors.Wrap(err, "Unable to create the config directory")
+	}
+
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", errors.Wrap(err, "Unable to store the token")
+	}
+
+	return path, nil
+}
+
+// login runs netlify's oauth ticket flow: create a ticket, have the user
+// authorize it in the browser, then exchange it for an access token
+func login(c *cli.Context) error {
+	cfg, err := newAnonymousConfig(c)
+	if err != nil {
+		return err
+	}
+
+	// the ticket endpoints must not see an old token
+	cfg.Token = ""
+
+	ticket, err := cfg.netlifyClient().Operations.CreateTicket(
+		operations.NewCreateTicketParams().WithTimeout(cfg.APITimeout).WithClientID(c.String("client-id")),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to create a login ticket")
+	}
+	ticketID := ticket.GetPayload().ID
+
+	authorizeURL := "https://app.netlify.com/authorize?response_type=ticket&ticket=" + ticketID
+	fmt.Printf("Authorize this tool in your browser:\n\n  %s\n\n", authorizeURL)
+	if isInteractive() {
+		if err := openBrowser(authorizeURL); err != nil {
+			log.Printf("[WARN] Unable to open a browser: %v", err)
+		}
+	}
+
+	deadline := cfg.clock.Now().Add(c.Duration("timeout"))
+	for {
+		if err := cfg.ctx.Err(); err != nil {
+			return errors.Wrap(err, "Stopped waiting for authorization")
+		}
+
+		shown, err := cfg.netlifyClient().Operations.ShowTicket(
+			operations.NewShowTicketParams().WithTimeout(cfg.APITimeout).WithTicketID(ticketID),
+			authInfo(cfg.Token),
+		)
+		if err != nil {
+			return errors.Wrap(classifyAPIError(err), "Unable to check the login ticket")
+		}
+
+		if shown.GetPayload().Authorized {
+			break
+		}
+
+		if cfg.clock.Now().After(deadline) {
+			return fmt.Errorf("%w: not authorized after %s", ErrWaitTimeout, c.Duration("timeout"))
+		}
+
+		cfg.clock.Sleep(2 * time.Second)
+	}
+
+	token, err := cfg.netlifyClient().Operations.ExchangeTicket(
+		operations.NewExchangeTicketParams().WithTimeout(cfg.APITimeout).WithTicketID(ticketID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to exchange the login ticket")
+	}
+
+	path, err := writeStoredToken(c.String("token-source"), token.GetPayload().AccessToken)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Logged in as %s, token stored in %s", token.GetPayload().UserEmail, path)
+
+	return nil
+}
+
+func logout(c *cli.Context) error {
+	if err := checkTokenSource(c.String("token-source")); err != nil {
+		return err
+	}
+
+	if c.String("token-source") == tokenSourceKeyring {
+		if err := keyringDelete(); err != nil {
+			return errors.Wrap(err, "Unable to remove the token from the keyring")
+		}
+
+		log.Print("Logged out")
+		return nil
+	}
+
+	path, err := storedTokenPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "Unable to remove the stored token")
+	}
+
+	log.Print("Logged out")
+
+	return nil
+}
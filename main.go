@@ -3,13 +3,23 @@ package main
 import (
 	"context"
 	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"hash"
 	"io"
 	"log"
+	"math/rand"
+	"net/http"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/urfave/cli/v2"
@@ -24,18 +34,18 @@ import (
 	"github.com/sethvargo/go-retry"
 )
 
-func mustGetSha1(filename string) string {
+func getSha1(filename string) (string, error) {
 	f, err := os.Open(filename)
 	if err != nil {
-		panic(errors.Wrap(err, "Unable to open file to sha it"))
+		return "", errors.Wrap(err, "Unable to open file to sha it")
 	}
 	defer f.Close()
 
 	hash := sha1.New()
 	if _, err := io.Copy(hash, f); err != nil {
-		panic(errors.Wrap(err, "unable to copy to sha"))
+		return "", errors.Wrap(err, "unable to copy to sha")
 	}
-	return fmt.Sprintf("%x", hash.Sum(nil))
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
 /*
@@ -47,11 +57,16 @@ func debug(i interface{}) {
 
 func authInfo(netlifyAccessToken string) runtime.ClientAuthInfoWriter {
 	return runtime.ClientAuthInfoWriterFunc(func(r runtime.ClientRequest, _ strfmt.Registry) error {
-		err := r.SetHeaderParam("User-Agent", "User-Agent: netlifyGolangDeploy/0.0.0")
+		err := r.SetHeaderParam("User-Agent", userAgent())
 		if err != nil {
 			return errors.Wrap(err, "Unable to set useragent header")
 		}
 
+		if netlifyAccessToken == "" {
+			// logging in, the oauth ticket endpoints take no token
+			return nil
+		}
+
 		err = r.SetHeaderParam("Authorization", "Bearer "+netlifyAccessToken)
 		if err != nil {
 			return errors.Wrap(err, "Unable to set authorization header")
@@ -61,155 +76,772 @@ func authInfo(netlifyAccessToken string) runtime.ClientAuthInfoWriter {
 	})
 }
 
-type uploadQueueAction func() error
+type uploadQueueAction func(ctx context.Context) error
 
 type config struct {
 	Token     string
 	Site      string
+	Sites     []string
+	Account   string
 	Directory string
 	Branch    string
 	Title     string
+	Message   string
 	QueueSize int
+	Walkers   int
 	Draft     bool
+	Resume    string
+
+	ManifestOut    string
+	SiteIgnoreCase bool
+
+	AlwaysUpload        []string
+	SubstituteEnv       []string
+	AllowSensitiveFiles bool
+	MaxFileSize         int64
+	SkipOversized       bool
+	StrictRules         bool
+	EdgeFunctionsDir    string
+	FunctionsDir        string
+	GoFunctions         bool
+	ESBuild             string
+	PathPrefix          string
+	Sources             []sourceDir
+	OverlayDir          string
+	WarmPaths           []string
+	WarmSitemap         bool
+	WarmConcurrency     int
+	BuildCmd            string
+	BuildDir            string
+	BuildEnv            map[string]string
+	PreHook             string
+	PostHook            string
+	ReadyGrace          time.Duration
+	ReadyVerify         bool
+	WaitTimeout         time.Duration
+	PollInterval        time.Duration
+	PollMaxInterval     time.Duration
+	NoWait              bool
+	Open                bool
+	SlackWebhook        string
+	MetricsPushURL      string
+	GitHubPRComment     bool
+	GitLabMRComment     bool
+	UploadMinSpeed      int64
+	UploadVerifyRetries int
+	Watch               bool
+	WatchDebounce       time.Duration
+	WatchPoll           bool
+
+	TLSMinVersion uint16
+	InsecureHTTP  bool
+	DisableHTTP2  bool
+	APITimeout    time.Duration
+	RootCAs       *x509.CertPool
+	SkipTLSVerify bool
+	ClientCerts   []tls.Certificate
+
+	httpClient *http.Client
+	events     *eventWriter
+	limiter    *adaptiveLimiter
+	rateLimit  *rateLimit
+	cache      *daemonCache
+	tracer     *tracer
+	clock      clock
+	random     func(n int64) int64 // poll jitter, rand.Int63n outside of tests
+	ctx        context.Context
 }
 
+// shaData is one file in shaToFilename, which maps content to every file
+// that has it. netlify only lists a sha once in required but each path has to
+// be uploaded to be served.
 type shaData struct {
 	realfilename string
 	uri          string
+	// substitute is set when the sha was taken with --substitute-env
+	// placeholders rendered, so the upload has to render them too
+	substitute bool
 }
 
-func (cfg *config) findSite(siteName string) (*netlify.Site, error) {
-	page := int32(1)
-	perPage := int32(25)
-	filter := "all"
+// shaFile finds uri among the files with sha as their content
+func shaFile(shaToFilename map[string][]*shaData, sha string, uri string) *shaData {
+	for _, data := range shaToFilename[sha] {
+		if data.uri == uri {
+			return data
+		}
+	}
 
-	for {
-		// List sites
-		sites, err := netlifyClient().Operations.ListSites(
-			operations.NewListSitesParams().WithPage(&page).WithPerPage(&perPage).WithFilter(&filter),
+	return nil
+}
+
+// removeShaFile drops uri from the files with sha as their content
+func removeShaFile(shaToFilename map[string][]*shaData, sha string, uri string) {
+	files := []*shaData{}
+	for _, data := range shaToFilename[sha] {
+		if data.uri != uri {
+			files = append(files, data)
+		}
+	}
+
+	if len(files) == 0 {
+		delete(shaToFilename, sha)
+		return
+	}
+	shaToFilename[sha] = files
+}
+
+// siteQuery narrows down the sites listSitesPage returns
+type siteQuery struct {
+	// Name only matches sites whose name contains it
+	Name string
+	// Filter is all, owner or guest, the account listing doesn't support it
+	Filter string
+}
+
+// listSitesPage lists every site the token can see, or only those of
+// --account so same named sites in different teams can't be mixed up
+func (cfg *config) listSitesPage(query siteQuery, page int32, perPage int32) ([]*netlify.Site, error) {
+	var name *string
+	if query.Name != "" {
+		name = &query.Name
+	}
+
+	if cfg.Account != "" {
+		sites, err := cfg.netlifyClient().Operations.ListSitesForAccount(
+			operations.NewListSitesForAccountParams().WithTimeout(cfg.APITimeout).WithAccountSlug(cfg.Account).WithName(name).WithPage(&page).WithPerPage(&perPage),
 			authInfo(cfg.Token),
 		)
+		if err != nil {
+			return nil, err
+		}
+		return sites.GetPayload(), nil
+	}
+
+	filter := query.Filter
+	if filter == "" {
+		filter = "all"
+	}
+	sites, err := cfg.netlifyClient().Operations.ListSites(
+		operations.NewListSitesParams().WithTimeout(cfg.APITimeout).WithName(name).WithPage(&page).WithPerPage(&perPage).WithFilter(&filter),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sites.GetPayload(), nil
+}
 
+// eachSite pages through the sites matching query until visit returns false
+// or there are no more
+func (cfg *config) eachSite(query siteQuery, visit func(site *netlify.Site) bool) error {
+	page := int32(1)
+	perPage := int32(25)
+
+	for {
+		sites, err := cfg.listSitesPage(query, page, perPage)
 		if err != nil {
-			return nil, errors.Wrap(err, "Unable to get a list of sites")
+			return errors.Wrap(classifyAPIError(err), "Unable to get a list of sites")
 		}
 
-		if len(sites.GetPayload()) == 0 {
-			return nil, nil
+		if len(sites) == 0 {
+			return nil
 		}
 
-		for _, site := range sites.GetPayload() {
-			if site.Name == siteName {
-				return site, nil
+		for _, site := range sites {
+			if !visit(site) {
+				return nil
 			}
 		}
 
 		page++
-		log.Printf("[DEBUG] Site wasn't found, looking for site '%s' with page '%d' and per_page '%d'", siteName, page, perPage)
+		log.Printf("[DEBUG] Listing sites with page '%d' and per_page '%d'", page, perPage)
+	}
+}
+
+// siteHasDomain reports if domain is the site's custom domain, one of its
+// aliases or its netlify.app subdomain
+func siteHasDomain(site *netlify.Site, domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if strings.EqualFold(site.CustomDomain, domain) || domain == site.Name+".netlify.app" {
+		return true
+	}
+
+	for _, alias := range site.DomainAliases {
+		if strings.EqualFold(alias, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findSite asks the api for sites with siteName in their name, which is
+// usually one page, and only pages through every site if that finds nothing.
+// Site names can't have dots, so a siteName with one is taken as a domain.
+func (cfg *config) findSite(siteName string) (*netlify.Site, error) {
+	var found *netlify.Site
+
+	if strings.Contains(siteName, ".") {
+		err := cfg.eachSite(siteQuery{}, func(site *netlify.Site) bool {
+			if siteHasDomain(site, siteName) {
+				found = site
+				return false
+			}
+			return true
+		})
+		return found, err
+	}
+
+	if cfg.SiteIgnoreCase {
+		siteName = strings.ToLower(siteName)
+	}
+
+	match := func(site *netlify.Site) bool {
+		if site.Name == siteName || (cfg.SiteIgnoreCase && strings.EqualFold(site.Name, siteName)) {
+			found = site
+			return false
+		}
+		return true
 	}
+
+	if err := cfg.eachSite(siteQuery{Name: siteName}, match); err != nil || found != nil {
+		return found, err
+	}
+
+	log.Printf("[DEBUG] Site '%s' wasn't found by name, looking through every site", siteName)
+	err := cfg.eachSite(siteQuery{}, match)
+
+	return found, err
 }
 
-func netlifyClient() *plumbing.Netlify {
-	netlifyAPIHost := "api.netlify.com"
-	netlifyAPIPath := "/api/v1"
+const (
+	netlifyAPIHost = "api.netlify.com"
+	netlifyAPIPath = "/api/v1"
+)
 
-	transport := openapiClient.New(netlifyAPIHost, netlifyAPIPath, plumbing.DefaultSchemes)
+func (cfg *config) netlifyClient() *plumbing.Netlify {
+	transport := openapiClient.NewWithClient(netlifyAPIHost, netlifyAPIPath, cfg.schemes(), cfg.httpClient)
+	// calls without a context of their own get their params timeout on top
+	// of this one
+	transport.Context = cfg.ctx
 	client := plumbing.New(transport, strfmt.Default)
 
 	return client
 }
 
-func (cfg *config) getDeploy(deployID string, wantedStatus string) (*netlify.Deploy, error) {
+// deployWithSummary is a deploy along with the summary of its processing
+// (rules parsed, forms found, assets optimized), which the generated model
+// leaves out
+type deployWithSummary struct {
+	netlify.Deploy
+	Summary struct {
+		Messages []struct {
+			Type        string `json:"type"`
+			Title       string `json:"title"`
+			Description string `json:"description"`
+		} `json:"messages"`
+	} `json:"summary"`
+}
+
+// logNewMessages logs the processing messages that weren't in earlier polls,
+// so a long wait shows what netlify is doing
+func (d *deployWithSummary) logNewMessages(seen map[string]bool) {
+	for _, message := range d.Summary.Messages {
+		key := message.Title + "\x00" + message.Description
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		level := ""
+		if message.Type == "warning" {
+			level = "[WARN] "
+		}
+		log.Printf("%s%s: %s", level, message.Title, message.Description)
+	}
+}
+
+// failedDeployStates are the states a deploy never leaves, so waiting any
+// longer is pointless
+var failedDeployStates = map[string]bool{
+	"error":     true,
+	"rejected":  true,
+	"cancelled": true,
+}
+
+// getDeploy polls until the deploy reaches wantedStatus. Netlify's API has no
+// streaming (SSE/websocket) deploy status endpoint, so polling is the only
+// option; state changes are logged as soon as a poll sees them.
+func (cfg *config) getDeploy(deployID string, wantedStatus string) (deploy *netlify.Deploy, err error) {
+	span := cfg.tracer.start("wait_"+wantedStatus, spanKindClient)
+	span.setAttribute("netlify.deploy_id", deployID)
+	defer func() { span.finish(err) }()
+
+	lastState := ""
+	seenMessages := map[string]bool{}
+	delay := cfg.PollInterval
+	deadline := cfg.clock.Now().Add(cfg.WaitTimeout)
 	for {
-		deploy, err := netlifyClient().Operations.GetDeploy(
-			operations.NewGetDeployParams().WithDeployID(deployID),
-			authInfo(cfg.Token),
-		)
-		if err != nil {
+		if err := cfg.ctx.Err(); err != nil {
+			return nil, errors.Wrapf(err, "Stopped waiting for deploy %s", deployID)
+		}
+
+		polled := &deployWithSummary{}
+		if _, err := cfg.apiGet("/deploys/"+deployID, polled); err != nil {
 			return nil, errors.Wrap(err, "Unable to check deploy")
 		}
+		deploy = &polled.Deploy
+		polled.logNewMessages(seenMessages)
+
+		if deploy.State != lastState {
+			lastState = deploy.State
+			delay = cfg.PollInterval
+			log.Printf("Deploy %s is %s", deployID, lastState)
+			cfg.events.emit(outputEvent{Event: "state", DeployID: deployID, State: lastState})
+		}
+
+		if failedDeployStates[deploy.State] {
+			message := deploy.ErrorMessage
+			if message == "" {
+				message = "no error message given"
+			}
+			return nil, fmt.Errorf("%w: deploy %s is %s: %s", ErrDeployFailed, deployID, deploy.State, message)
+		}
 
-		if deploy.GetPayload().State == wantedStatus {
+		if deploy.State == wantedStatus {
 			// site is ready
-			return deploy.GetPayload(), nil
+			return deploy, nil
 		}
 
 		// site is done somehow
-		if deploy.GetPayload().State == "ready" {
-			return deploy.GetPayload(), nil
+		if deploy.State == "ready" {
+			return deploy, nil
+		}
+
+		if cfg.WaitTimeout > 0 && cfg.clock.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: deploy %s is still %s after %s", ErrWaitTimeout, deployID, lastState, cfg.WaitTimeout)
 		}
 
-		time.Sleep(time.Duration(1) * time.Second)
+		cfg.clock.Sleep(pollJitter(delay, cfg.random))
+		delay = nextPollDelay(delay, cfg.PollMaxInterval)
 	}
 }
 
-func (cfg *config) wrapUploadJob(deployID string, realFilename string, uri string) func() error {
-	auth := authInfo(cfg.Token)
+// nextPollDelay doubles the wait between deploy state checks up to max, so
+// long processing doesn't mean a request every second
+func nextPollDelay(delay time.Duration, max time.Duration) time.Duration {
+	delay *= 2
+	if delay > max {
+		return max
+	}
+	return delay
+}
 
-	return func() error {
-		f, err := os.Open(realFilename)
-		if err != nil {
-			return errors.Wrap(err, "Unable to open file")
-		}
+// pollJitter picks a random wait between half of delay and delay, so deploys
+// started together don't keep polling together
+func pollJitter(delay time.Duration, random func(n int64) int64) time.Duration {
+	if delay < 2 {
+		return delay
+	}
+	return delay/2 + time.Duration(random(int64(delay/2)))
+}
+
+// hashingReader hashes a file while it is streamed to netlify. The sha
+// netlify asked for was taken while collecting files, this checks the bytes
+// actually sent still match it, catching a file rewritten in between.
+type hashingReader struct {
+	io.Reader
+	io.Closer
+	hash hash.Hash
+	size int64
+}
+
+func (r *hashingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func newHashingReader(f io.ReadCloser) *hashingReader {
+	h := sha1.New()
+	return &hashingReader{
+		Reader: io.TeeReader(f, h),
+		Closer: f,
+		hash:   h,
+	}
+}
+
+func (r *hashingReader) sum() string {
+	return fmt.Sprintf("%x", r.hash.Sum(nil))
+}
 
-		body := operations.NewUploadDeployFileParams().WithDeployID(deployID).WithPath(uri).WithFileBody(f)
+func (cfg *config) wrapUploadJob(report *deployReport, deployID string, upload pendingUpload) uploadQueueAction {
+	auth := authInfo(cfg.Token)
+	realFilename, uri, sha := upload.realfilename, upload.uri, upload.sha
+
+	return func(ctx context.Context) (err error) {
+		span := cfg.tracer.start("upload", spanKindClient)
+		span.setAttribute("netlify.path", uri)
+		span.setAttribute("netlify.sha", sha)
+		defer func() { span.finish(err) }()
 
 		// initial 5 second delay - https://github.com/netlify/cli/blob/f563cc794fbcb8f9d716dc36a0f7d792f0cf325a/src/utils/deploy/constants.mjs#L14
-		backoff := retry.NewFibonacci(5 * time.Second)
+		// jittered so a queue full of uploads failing together (a brief api
+		// outage) doesn't retry in lockstep
+		backoff := retry.WithJitterPercent(uploadRetryJitter, retry.NewFibonacci(5*time.Second))
 
-		// Ensure the maximum total retry time is 90s.
-		// 90 second max from https://github.com/netlify/cli/blob/f563cc794fbcb8f9d716dc36a0f7d792f0cf325a/src/utils/deploy/constants.mjs#L16
-		backoff = retry.WithMaxDuration(90*time.Second, backoff)
+		var size int64
+		if info, err := os.Stat(realFilename); err == nil {
+			size = info.Size()
+		}
+		backoff = clockBackoff(cfg.clock, uploadRetryBudget(size, cfg.UploadMinSpeed), backoff)
 
-		ctx := context.Background()
+		attempts := 0
 		err = retry.Do(ctx, backoff, func(ctx context.Context) error {
-			_, err = netlifyClient().Operations.UploadDeployFile(body, auth)
-			if err != nil && strings.Contains(err.Error(), "GOAWAY") {
+			attempts++
+			if attempts > 1 {
+				atomic.AddInt64(&report.Retries, 1)
+			}
+
+			// reopened on every attempt, a failed attempt has already consumed the file
+			f, err := openForUpload(realFilename, upload.substitute)
+			if err != nil {
+				return errors.Wrap(err, "Unable to open file")
+			}
+
+			// the runtime ignores a params timeout once the params carry a
+			// context, so the deadline goes on the context
+			callCtx, cancel := context.WithTimeout(ctx, uploadTimeout(size, cfg.UploadMinSpeed, cfg.APITimeout))
+			reader := newHashingReader(f)
+			body := operations.NewUploadDeployFileParams().
+				WithContext(callCtx).
+				WithDeployID(deployID).
+				WithPath(uri).
+				WithFileBody(reader)
+
+			_, err = cfg.netlifyClient().Operations.UploadDeployFile(body, auth)
+			cancel()
+			f.Close()
+			if err != nil && isThrottled(err) {
+				cfg.limiter.throttled()
 				return retry.RetryableError(err)
 			}
-			return err
+			if err != nil && ctx.Err() == nil && isTimeout(err) {
+				return retry.RetryableError(err)
+			}
+			if err != nil {
+				return err
+			}
+			cfg.limiter.succeeded()
+
+			if reader.sum() != sha {
+				return fmt.Errorf("%w: %s changed while deploying, uploaded %s but expected %s", ErrUploadFailed, realFilename, reader.sum(), sha)
+			}
+
+			atomic.AddInt64(&report.FilesUploaded, 1)
+			atomic.AddInt64(&report.BytesUploaded, reader.size)
+			cfg.events.emit(outputEvent{Event: "file_uploaded", DeployID: deployID, Path: uri, Sha: sha, Bytes: reader.size})
+			span.setAttribute("netlify.bytes", reader.size)
+			return nil
 		})
+		span.setAttribute("netlify.attempts", attempts)
 
-		return errors.Wrap(err, "Unable to upload file")
+		return errors.Wrap(classifyAPIError(err), "Unable to upload file")
 	}
 }
 
-func filesInDirectory(dir string) (map[string]string, map[string]*shaData, error) {
-	filenameToSha := map[string]string{}
-	shaToFilename := map[string]*shaData{}
+type pendingUpload struct {
+	realfilename string
+	uri          string
+	sha          string
+	substitute   bool
+}
+
+// requiredUploads lists an upload for every path whose content netlify
+// asked for. Netlify lists each sha once, however many paths share it, and
+// each of those paths needs its own upload.
+func requiredUploads(deployID string, required []string, shaToFilename map[string][]*shaData) ([]pendingUpload, error) {
+	uploads := []pendingUpload{}
+	for _, sha := range required {
+		files, ok := shaToFilename[sha]
+		if !ok {
+			return nil, fmt.Errorf("deploy %s needs %s which isn't in deployDir, has it changed since the deploy was created?", deployID, sha)
+		}
+
+		for _, data := range files {
+			log.Printf("Enqueuing upload of %s", data.realfilename)
+			uploads = append(uploads, pendingUpload{data.realfilename, data.uri, sha, data.substitute})
+		}
+	}
+
+	return uploads, nil
+}
+
+// uploadJobs turns uploads into jobs, largest file first so one big file
+// doesn't start last and leave every other worker idle while it finishes
+func (cfg *config) uploadJobs(report *deployReport, deployID string, uploads []pendingUpload) []uploadQueueAction {
+	sizes := map[string]int64{}
+	for _, upload := range uploads {
+		if info, err := os.Stat(upload.realfilename); err == nil {
+			sizes[upload.realfilename] = info.Size()
+		}
+	}
+
+	sort.SliceStable(uploads, func(i, j int) bool {
+		return sizes[uploads[i].realfilename] > sizes[uploads[j].realfilename]
+	})
+
+	jobs := []uploadQueueAction{}
+	for _, upload := range uploads {
+		jobs = append(jobs, cfg.wrapUploadJob(report, deployID, upload))
+	}
+
+	return jobs
+}
+
+const (
+	// uploadRetryJitter is the percentage the upload retry delays vary by
+	uploadRetryJitter = 25
+	// uploadWorkerStagger is how far apart the upload workers start
+	uploadWorkerStagger = 50 * time.Millisecond
+)
+
+// runUploads runs jobs on QueueSize workers and waits for them all, with
+// --queueSize auto the limiter decides how many of them are busy. The first
+// job to fail cancels the rest and is returned. Being interrupted isn't an
+// error here, callers check cfg.ctx for that.
+func (cfg *config) runUploads(jobs []uploadQueueAction) error {
+	jobChan := make(chan uploadQueueAction, cfg.QueueSize)
+
+	ctx, cancel := context.WithCancel(cfg.ctx)
+	defer cancel()
+
+	var failOnce sync.Once
+	var failed error
+
+	var wg sync.WaitGroup
+	for i := 0; i < cfg.QueueSize; i++ {
+		wg.Add(1)
+
+		go func(worker int) {
+			defer wg.Done()
+
+			// stagger the workers so they don't start, and so fail and retry,
+			// all at the same moment
+			cfg.clock.Sleep(time.Duration(worker) * uploadWorkerStagger)
+
+			for job := range jobChan {
+				if ctx.Err() != nil {
+					// interrupted or another upload failed, drain the queue without uploading
+					continue
+				}
+
+				if cfg.limiter != nil {
+					cfg.limiter.acquire()
+				}
+				err := job(ctx)
+				if cfg.limiter != nil {
+					cfg.limiter.release()
+				}
+				if err != nil && ctx.Err() == nil {
+					failOnce.Do(func() {
+						failed = err
+						cancel()
+					})
+				}
+			}
+		}(i)
+	}
+
+	for _, job := range jobs {
+		jobChan <- job
+	}
+
+	close(jobChan)
+	wg.Wait()
+
+	if failed != nil && !errors.Is(failed, ErrUnauthorized) && !errors.Is(failed, ErrUploadFailed) {
+		return fmt.Errorf("%w: %v", ErrUploadFailed, failed)
+	}
+	return failed
+}
+
+// verifyUploads re-fetches the deploy after uploading and uploads again
+// anything netlify still lists as required, so an upload that was accepted
+// but dropped can't leave the deploy stuck waiting for a file.
+func (cfg *config) verifyUploads(report *deployReport, deployID string, shaToFilename map[string][]*shaData) error {
+	if cfg.UploadVerifyRetries <= 0 {
+		return nil
+	}
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := cfg.netlifyClient().Operations.GetDeploy(
+			operations.NewGetDeployParams().WithTimeout(cfg.APITimeout).WithDeployID(deployID),
+			authInfo(cfg.Token),
+		)
 		if err != nil {
-			return err
+			return errors.Wrap(classifyAPIError(err), "Unable to check uploads")
 		}
+		deploy := resp.GetPayload()
 
-		if info.IsDir() {
+		// once netlify has moved on to processing it has every file
+		if (deploy.State != "prepared" && deploy.State != "uploading") || len(deploy.Required) == 0 {
 			return nil
 		}
 
-		key, err := filepath.Rel(dir, path)
+		if attempt == cfg.UploadVerifyRetries {
+			return fmt.Errorf("%w: netlify still needs %d files for deploy %s after uploading them %d more times", ErrUploadFailed, len(deploy.Required), deployID, attempt)
+		}
+
+		log.Printf("[WARN] netlify still needs %d files for deploy %s, uploading them again", len(deploy.Required), deployID)
+
+		uploads, err := requiredUploads(deployID, deploy.Required, shaToFilename)
 		if err != nil {
 			return err
 		}
 
-		key = "/" + key
-		filenameToSha[key] = mustGetSha1(path)
-		shaToFilename[mustGetSha1(path)] = &shaData{
-			realfilename: path,
-			uri:          key,
+		if err := cfg.runUploads(cfg.uploadJobs(report, deployID, uploads)); err != nil {
+			return err
 		}
 
-		return nil
-	})
+		if err := cfg.ctx.Err(); err != nil {
+			return errors.Wrapf(err, "Interrupted while uploading deploy %s", deployID)
+		}
+	}
+}
+
+// uploadRetryBudget is how long a file of size bytes keeps being retried.
+// netlify cli uses a flat 90s - https://github.com/netlify/cli/blob/f563cc794fbcb8f9d716dc36a0f7d792f0cf325a/src/utils/deploy/constants.mjs#L16
+// which gives up on big files over slow links and waits far too long on a
+// broken deploy of thousands of tiny ones, so instead small files get 30s and
+// bigger ones as long as they'd take at minSpeed bytes per second on top.
+func uploadRetryBudget(size int64, minSpeed int64) time.Duration {
+	if minSpeed <= 0 {
+		return 90 * time.Second
+	}
+
+	return 30*time.Second + time.Duration(size/minSpeed)*time.Second
+}
+
+// uploadTimeout is how long one attempt at uploading size bytes may take,
+// --api-timeout plus as long as the file takes at minSpeed, so a big file on a
+// slow link isn't cut off at the same point as a tiny one
+func uploadTimeout(size int64, minSpeed int64, apiTimeout time.Duration) time.Duration {
+	if minSpeed <= 0 {
+		return apiTimeout
+	}
+
+	return apiTimeout + time.Duration(size/minSpeed)*time.Second
+}
+
+// matchesAnyGlob reports if uri matches one of the globs, with or without
+// its leading slash
+func matchesAnyGlob(globs []string, uri string) bool {
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, uri); ok {
+			return true
+		}
+
+		if ok, _ := path.Match(glob, strings.TrimPrefix(uri, "/")); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filesInDirectory hashes every file under dir. With more than one walker the
+// top level entries are split between goroutines, which helps on trees with
+// hundreds of thousands of files where the walk itself is the bottleneck.
+func filesInDirectory(dir string, walkers int, cache *daemonCache) (map[string]string, map[string][]*shaData, error) {
+	filenameToSha := map[string]string{}
+	shaToFilename := map[string][]*shaData{}
+	var mu sync.Mutex
+
+	walk := func(root string) error {
+		return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if info.IsDir() {
+				return nil
+			}
+
+			key, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+
+			key = "/" + key
+			sha, err := cache.sha1(path, info)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			filenameToSha[key] = sha
+			shaToFilename[sha] = append(shaToFilename[sha], &shaData{
+				realfilename: path,
+				uri:          key,
+			})
+
+			return nil
+		})
+	}
+
+	if walkers <= 1 {
+		err := walk(dir)
+		return filenameToSha, shaToFilename, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roots := make(chan string)
+	errs := make(chan error, len(entries))
+
+	var wg sync.WaitGroup
+	for i := 0; i < walkers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for root := range roots {
+				if err := walk(root); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+
+	for _, entry := range entries {
+		roots <- filepath.Join(dir, entry.Name())
+	}
+
+	close(roots)
+	wg.Wait()
+	close(errs)
+
+	if err, ok := <-errs; ok {
+		return nil, nil, err
+	}
 
-	return filenameToSha, shaToFilename, err
+	return filenameToSha, shaToFilename, nil
 }
 
 func main() {
 	app := &cli.App{
-		Name:   "deploy",
-		Usage:  "deploy a directory to netlify",
-		Action: deploy,
+		Name:    "deploy",
+		Usage:   "deploy a directory to netlify",
+		Version: version,
+		Action:  deploy,
+		Before:  applyFlagFiles,
 		Authors: []*cli.Author{
 			{
 				Name:  "Gavin Mogan",
@@ -217,12 +849,12 @@ func main() {
 			},
 		},
 		Flags: []cli.Flag{
-			&cli.StringFlag{
+			&cli.StringSliceFlag{
 				Name:    "deployDir",
 				Aliases: []string{"d"},
-				Usage:   "directory to be deployed to netlify",
+				Usage:   "directory to be deployed to netlify, a .zip file, or - to read a tar archive from stdin. Repeat as dir:/prefix to merge more directories into the deploy. Without it the framework found in the current directory (or --build-dir) decides: Hugo public, Next.js out, Jekyll _site, Vite dist",
 				EnvVars: []string{"NETLIFY_DIRECTORY"},
-				Value:   "./public",
+				Value:   cli.NewStringSlice("./public"),
 			},
 			&cli.StringFlag{
 				Name:        "token",
@@ -230,33 +862,383 @@ func main() {
 				Usage:       "api token to connect to netlify",
 				EnvVars:     []string{"NETLIFY_AUTH_TOKEN"},
 				DefaultText: "[censored]",
-				Required:    true,
+				Required:    false, // not every command talks to the api, checked in newConfig
 			},
-			&cli.StringFlag{
-				Name:     "siteName",
-				Aliases:  []string{"s"},
-				Usage:    "Site name to deploy to",
-				EnvVars:  []string{"NETLIFY_SITE"},
-				Required: true,
+			&cli.StringSliceFlag{
+				Name:     "sites",
+				Usage:    "More sites to deploy the same directory to at the same time, comma separated or repeated",
+				EnvVars:  []string{"NETLIFY_SITES"},
+				Required: false,
 			},
-			&cli.StringFlag{
-				Name:     "alias",
-				Aliases:  []string{"a"},
-				Usage:    "Site alias to deploy to",
-				EnvVars:  []string{"NETLIFY_ALIAS"},
+			&cli.BoolFlag{
+				Name:     "site-ignore-case",
+				Usage:    "Match siteName regardless of case",
+				EnvVars:  []string{"NETLIFY_SITE_IGNORE_CASE"},
 				Required: false,
 			},
 			&cli.StringFlag{
-				Name:     "title",
-				Usage:    "Title to label deploy as in logs",
-				EnvVars:  []string{"NETLIFY_TITLE"},
+				Name:     "account",
+				Usage:    "Team (account slug) to look the site up in, for when several teams have a site with the same name",
+				EnvVars:  []string{"NETLIFY_ACCOUNT"},
 				Required: false,
 			},
 			&cli.StringFlag{
-				Name:     "queueSize",
-				Usage:    "Number of parallel upload processes to use",
-				EnvVars:  []string{"NETLIFY_QUEUE_SIZE"},
-				Value:    "5",
+				Name:     "config",
+				Usage:    "yaml file of flag values, for keeping a deploy's settings in its repo. Flags and environment variables win over it",
+				EnvVars:  []string{"NETLIFY_DEPLOY_CONFIG"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "config-strict-env",
+				Usage:    "Fail when --config or the profile refers to an environment variable that isn't set, instead of leaving it empty",
+				EnvVars:  []string{"NETLIFY_DEPLOY_CONFIG_STRICT_ENV"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "profile",
+				Usage:    "Profile from config.yaml in the user config directory to take flag values from",
+				EnvVars:  []string{"NETLIFY_PROFILE"},
+				Value:    defaultProfile,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "token-source",
+				Usage:    "Where login stores the token and it is read from without --token, file or keyring (macOS keychain, windows credential manager, secret service)",
+				EnvVars:  []string{"NETLIFY_TOKEN_SOURCE"},
+				Value:    tokenSourceFile,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "siteName",
+				Aliases:  []string{"s"},
+				Usage:    "Site name to deploy to, or one of its domains like www.example.com",
+				EnvVars:  []string{"NETLIFY_SITE"},
+				Required: false, // not every command works on a site, checked in requireSite
+			},
+			&cli.StringFlag{
+				Name:     "alias",
+				Aliases:  []string{"a"},
+				Usage:    "Site alias to deploy to",
+				EnvVars:  []string{"NETLIFY_ALIAS"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "alias-from-branch",
+				Usage:    "Use the current git branch, made safe for a url, as the alias when --alias isn't given",
+				EnvVars:  []string{"NETLIFY_ALIAS_FROM_BRANCH"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "title",
+				Usage:    "Title to label deploy as in logs, defaults to the subject and short sha of the latest git commit",
+				EnvVars:  []string{"NETLIFY_TITLE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "message",
+				Usage:    "Longer description of the deploy, like the change it ships, for notifications, pull request comments and --output. Netlify itself only keeps the title",
+				EnvVars:  []string{"NETLIFY_MESSAGE"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "queueSize",
+				Usage:    "Number of parallel upload processes to use, or auto to ramp up while uploads succeed and back off when netlify throttles",
+				EnvVars:  []string{"NETLIFY_QUEUE_SIZE"},
+				Value:    "5",
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "walkers",
+				Usage:    "Number of top level directories to walk and hash in parallel",
+				EnvVars:  []string{"NETLIFY_WALKERS"},
+				Value:    1,
+				Required: false,
+			},
+			&cli.Int64Flag{
+				Name:     "upload-min-speed",
+				Usage:    "Slowest expected upload speed in bytes per second, each file gets retried for as long as its size needs at this speed, 0 for a flat 90s",
+				EnvVars:  []string{"NETLIFY_UPLOAD_MIN_SPEED"},
+				Value:    100 * 1024,
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "upload-verify-retries",
+				Usage:    "Times to upload again files netlify still needs once uploading is done, 0 to not check",
+				EnvVars:  []string{"NETLIFY_UPLOAD_VERIFY_RETRIES"},
+				Value:    2,
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "always-upload",
+				Usage:    "Glob of paths to upload even when netlify already has their content, can be repeated",
+				EnvVars:  []string{"NETLIFY_ALWAYS_UPLOAD"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "functions-dir",
+				Usage:    "directory of functions to package and deploy, defaults to the one netlify.toml names. Each function is a .js file, a directory with an entry file of the same name or index.js, or a ready made .zip",
+				EnvVars:  []string{"NETLIFY_FUNCTIONS_DIR"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "go-functions",
+				Usage:    "Build function directories of Go sources for netlify (linux/amd64) with the go toolchain and deploy the binaries",
+				EnvVars:  []string{"NETLIFY_GO_FUNCTIONS"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "esbuild",
+				Usage:    "esbuild binary to bundle functions with when netlify.toml sets node_bundler = \"esbuild\"",
+				EnvVars:  []string{"NETLIFY_ESBUILD"},
+				Value:    "esbuild",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "edge-functions-dir",
+				Usage:    "directory with bundled edge functions and their manifest.json, as written by the netlify edge bundler",
+				EnvVars:  []string{"NETLIFY_EDGE_FUNCTIONS_DIR"},
+				Value:    ".netlify/edge-functions-dist",
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "substitute-env",
+				Usage:    "Glob of text files whose ${VAR} placeholders are replaced with environment values as they are uploaded, can be repeated",
+				EnvVars:  []string{"NETLIFY_SUBSTITUTE_ENV"},
+				Required: false,
+			},
+			&cli.Int64Flag{
+				Name:     "max-file-size",
+				Usage:    "Warn about files larger than this many bytes, 0 to not check",
+				EnvVars:  []string{"NETLIFY_MAX_FILE_SIZE"},
+				Value:    defaultMaxFileSize,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "skip-oversized",
+				Usage:    "Leave files over --max-file-size out of the deploy instead of just warning",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "allow-sensitive-files",
+				Usage:    "Deploy files that look like secrets (.env, private keys, credential json) instead of refusing",
+				EnvVars:  []string{"NETLIFY_ALLOW_SENSITIVE_FILES"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "strict-rules",
+				Usage:    "Fail the deploy when _redirects or _headers have problems instead of warning",
+				EnvVars:  []string{"NETLIFY_STRICT_RULES"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "wait-timeout",
+				Usage:    "How long to wait for netlify to process the deploy, 0 waits forever",
+				EnvVars:  []string{"NETLIFY_WAIT_TIMEOUT"},
+				Value:    15 * time.Minute,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "poll-interval",
+				Usage:    "How long to wait before checking the deploy state again, doubled every check up to --poll-max-interval",
+				Value:    time.Second,
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "poll-max-interval",
+				Usage:    "Longest wait between deploy state checks",
+				Value:    30 * time.Second,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "no-wait",
+				Usage:    "Exit once everything is uploaded instead of waiting for netlify to finish processing",
+				EnvVars:  []string{"NETLIFY_NO_WAIT"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "open",
+				Usage:    "Open the deploy in a browser once it is ready, when running in a terminal",
+				EnvVars:  []string{"NETLIFY_OPEN"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:        "notify-slack-webhook",
+				Usage:       "Slack incoming webhook url to post the deploy result to",
+				EnvVars:     []string{"NETLIFY_NOTIFY_SLACK_WEBHOOK"},
+				DefaultText: "[censored]",
+				Required:    false,
+			},
+			&cli.StringFlag{
+				Name:     "metrics-push-url",
+				Usage:    "Prometheus pushgateway url to push deploy metrics to",
+				EnvVars:  []string{"NETLIFY_METRICS_PUSH_URL"},
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "ready-grace",
+				Usage:    "How long to wait after netlify says the deploy is ready, to let the CDN catch up",
+				EnvVars:  []string{"NETLIFY_READY_GRACE"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "ready-verify",
+				Usage:    "During --ready-grace, re-fetch index.html until the CDN serves the new deploy",
+				EnvVars:  []string{"NETLIFY_READY_VERIFY"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "tls-min-version",
+				Usage:    "Minimum TLS version to use when talking to netlify (1.2 or 1.3)",
+				EnvVars:  []string{"NETLIFY_TLS_MIN_VERSION"},
+				Value:    "1.2",
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "api-timeout",
+				Usage:    "How long a single api call may take, file uploads also get as long as their size needs at --upload-min-speed",
+				EnvVars:  []string{"NETLIFY_API_TIMEOUT"},
+				Value:    30 * time.Second,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "insecure-http",
+				Usage:    "Talk to the api over plain http instead of https, only useful behind a local proxy",
+				EnvVars:  []string{"NETLIFY_INSECURE_HTTP"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "ca-cert",
+				Usage:    "PEM file of extra certificate authorities to trust, like the one of a tls intercepting proxy",
+				EnvVars:  []string{"NETLIFY_CA_CERT"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "client-cert",
+				Usage:    "PEM client certificate to present, for egress gateways that require mutual tls",
+				EnvVars:  []string{"NETLIFY_CLIENT_CERT"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "client-key",
+				Usage:    "PEM private key of --client-cert",
+				EnvVars:  []string{"NETLIFY_CLIENT_KEY"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "insecure-skip-tls-verify",
+				Usage:    "Don't verify tls certificates at all, prefer --ca-cert",
+				EnvVars:  []string{"NETLIFY_INSECURE_SKIP_TLS_VERIFY"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "disable-http2",
+				Usage:    "Talk to the api over http/1.1, for proxies and middleboxes that break long http/2 connections",
+				EnvVars:  []string{"NETLIFY_DISABLE_HTTP2"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "output",
+				Usage:    "text for logs only, or ndjson to also write versioned json events to stdout",
+				Value:    "text",
+				EnvVars:  []string{"NETLIFY_OUTPUT"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "github-pr-comment",
+				Usage:    "Post the deploy url as a comment on the pull request, using GITHUB_TOKEN and the github actions environment",
+				EnvVars:  []string{"NETLIFY_GITHUB_PR_COMMENT"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "gitlab-mr-comment",
+				Usage:    "Post the deploy url as a note on the merge request, using GITLAB_TOKEN and the gitlab ci environment",
+				EnvVars:  []string{"NETLIFY_GITLAB_MR_COMMENT"},
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "warm-paths",
+				Usage:    "Paths to request once the deploy is live so the CDN has them cached, can be repeated",
+				EnvVars:  []string{"NETLIFY_WARM_PATHS"},
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "warm-sitemap",
+				Usage:    "Also request every page listed in the deploy's sitemap.xml",
+				EnvVars:  []string{"NETLIFY_WARM_SITEMAP"},
+				Required: false,
+			},
+			&cli.IntFlag{
+				Name:     "warm-concurrency",
+				Usage:    "How many paths to request at once when warming",
+				Value:    8,
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "build-cmd",
+				Usage:    "Shell command that builds deployDir, run first with its output shown. The deploy is aborted if it fails",
+				EnvVars:  []string{"NETLIFY_BUILD_CMD"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "build-dir",
+				Usage:    "Directory to run --build-cmd in",
+				EnvVars:  []string{"NETLIFY_BUILD_DIR"},
+				Required: false,
+			},
+			&cli.StringSliceFlag{
+				Name:     "build-env",
+				Usage:    "KEY=VALUE to add to --build-cmd's environment on top of ours, repeat for more",
+				EnvVars:  []string{"NETLIFY_BUILD_ENV"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "pre-hook",
+				Usage:    "Shell command to run before deployDir is hashed, DEPLOY_DIR is set for it",
+				EnvVars:  []string{"NETLIFY_PRE_HOOK"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "post-hook",
+				Usage:    "Shell command to run once the deploy is ready, with SITE_NAME, DEPLOY_ID, DEPLOY_URL, DEPLOY_SITE, DEPLOY_TITLE and DEPLOY_MESSAGE set",
+				EnvVars:  []string{"NETLIFY_POST_HOOK"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "overlay-dir",
+				Usage:    "Directory whose files replace the files at the same path in deployDir, like an environment's robots.txt",
+				EnvVars:  []string{"NETLIFY_OVERLAY_DIR"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "path-prefix",
+				Usage:    "Deploy deployDir under this path, like /docs, keeping the rest of the published site as it is",
+				EnvVars:  []string{"NETLIFY_PATH_PREFIX"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "manifest-out",
+				Usage:    "Write every deployed path with its sha, and which ones netlify asked for, to this json file",
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:     "resume",
+				Usage:    "Deploy id of an interrupted deploy to finish uploading instead of creating a new one",
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "watch",
+				Usage:    "Keep running and make a new draft deploy whenever deployDir or --overlay-dir changes",
+				Required: false,
+			},
+			&cli.DurationFlag{
+				Name:     "watch-debounce",
+				Usage:    "How long changes must settle before --watch deploys, and how often it checks where there are no file events",
+				Value:    time.Second,
+				Required: false,
+			},
+			&cli.BoolFlag{
+				Name:     "watch-poll",
+				Usage:    "Poll for changes every --watch-debounce instead of using file events, for network and container mounts where events never arrive",
 				Required: false,
 			},
 			&cli.BoolFlag{
@@ -267,102 +1249,604 @@ func main() {
 				Required: false,
 			},
 		},
+		Commands: []*cli.Command{
+			{
+				Name:      "promote",
+				Usage:     "publish an existing draft deploy to production",
+				ArgsUsage: "<deploy-id>",
+				Action:    promote,
+			},
+			{
+				Name:      "lock",
+				Usage:     "lock a deploy so new deploys are not auto published",
+				ArgsUsage: "<deploy-id>",
+				Action:    lockDeploy,
+			},
+			{
+				Name:      "unlock",
+				Usage:     "unlock a previously locked deploy",
+				ArgsUsage: "<deploy-id>",
+				Action:    unlockDeploy,
+			},
+			{
+				Name:      "status",
+				Usage:     "show the state of an existing deploy",
+				ArgsUsage: "<deploy-id>",
+				Action:    deployStatus,
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "wait",
+						Usage: "Block until the deploy is ready or has failed",
+					},
+				},
+			},
+			buildHookCommand,
+			siteCommand,
+			dnsCommand,
+			domainCommand,
+			sslCommand,
+			formsCommand,
+			apiCommand,
+			verifyCommand,
+			diffCommand,
+			deploysCommand,
+			aliasCommand,
+			daemonCommand,
+			serveCommand,
+			loginCommand,
+			logoutCommand,
+			docsCommand,
+			selfUpdateCommand,
+			whoamiCommand,
+			{
+				Name:   "arch-info",
+				Usage:  "print the release artifact name matching this binary",
+				Action: archInfo,
+			},
+			{
+				Name:   "version",
+				Usage:  "print the version, commit and build date of this binary",
+				Action: versionInfo,
+			},
+			{
+				Name:   "doctor",
+				Usage:  "check this machine can deploy to netlify",
+				Action: doctor,
+			},
+		},
 	}
 
-	err := app.Run(os.Args)
+	// SIGTERM is how docker and kubernetes stop us, treat it like ctrl-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := app.RunContext(ctx, os.Args)
 	if err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		stop()
+		os.Exit(exitCode(err))
 	}
 }
 
-func deploy(c *cli.Context) error {
+// rootContext is the context of the app itself. Subcommands run as apps of
+// their own, and the very top of the lineage is an empty context.
+func rootContext(c *cli.Context) *cli.Context {
+	root := c
+	for _, ctx := range c.Lineage() {
+		if ctx.App != nil {
+			root = ctx
+		}
+	}
+	return root
+}
+
+func newConfig(c *cli.Context) (config, error) {
+	cfg, err := newAnonymousConfig(c)
+	if err != nil {
+		return cfg, err
+	}
+
+	if cfg.Token == "" {
+		return cfg, fmt.Errorf("Required flag \"token\" not set, pass it or run login")
+	}
+
+	return cfg, nil
+}
+
+// newAnonymousConfig is newConfig for the commands that work before there is
+// a token, like login
+func newAnonymousConfig(c *cli.Context) (config, error) {
 	cfg := config{
-		Token:     c.String("token"),
-		Site:      c.String("siteName"),
-		Directory: c.String("deployDir"),
-		Branch:    c.String("alias"),
-		Title:     c.String("title"),
-		QueueSize: c.Int("queueSize"),
-		Draft:     c.Bool("draft"),
+		Token:               c.String("token"),
+		Site:                c.String("siteName"),
+		Sites:               c.StringSlice("sites"),
+		SiteIgnoreCase:      c.Bool("site-ignore-case"),
+		Account:             c.String("account"),
+		Sources:             parseSourceDirs(c.StringSlice("deployDir")),
+		OverlayDir:          c.String("overlay-dir"),
+		WarmPaths:           c.StringSlice("warm-paths"),
+		WarmSitemap:         c.Bool("warm-sitemap"),
+		WarmConcurrency:     c.Int("warm-concurrency"),
+		BuildCmd:            c.String("build-cmd"),
+		BuildDir:            c.String("build-dir"),
+		PreHook:             c.String("pre-hook"),
+		PostHook:            c.String("post-hook"),
+		Branch:              c.String("alias"),
+		Title:               c.String("title"),
+		Message:             c.String("message"),
+		QueueSize:           c.Int("queueSize"),
+		Walkers:             c.Int("walkers"),
+		Draft:               c.Bool("draft"),
+		Resume:              c.String("resume"),
+		ManifestOut:         c.String("manifest-out"),
+		AlwaysUpload:        c.StringSlice("always-upload"),
+		SubstituteEnv:       c.StringSlice("substitute-env"),
+		AllowSensitiveFiles: c.Bool("allow-sensitive-files"),
+		MaxFileSize:         c.Int64("max-file-size"),
+		SkipOversized:       c.Bool("skip-oversized"),
+		StrictRules:         c.Bool("strict-rules"),
+		EdgeFunctionsDir:    c.String("edge-functions-dir"),
+		FunctionsDir:        c.String("functions-dir"),
+		GoFunctions:         c.Bool("go-functions"),
+		ESBuild:             c.String("esbuild"),
+		PathPrefix:          normalizePathPrefix(c.String("path-prefix")),
+		ReadyGrace:          c.Duration("ready-grace"),
+		ReadyVerify:         c.Bool("ready-verify"),
+		WaitTimeout:         c.Duration("wait-timeout"),
+		PollInterval:        c.Duration("poll-interval"),
+		PollMaxInterval:     c.Duration("poll-max-interval"),
+		NoWait:              c.Bool("no-wait"),
+		Open:                c.Bool("open"),
+		SlackWebhook:        c.String("notify-slack-webhook"),
+		MetricsPushURL:      c.String("metrics-push-url"),
+		GitHubPRComment:     c.Bool("github-pr-comment"),
+		GitLabMRComment:     c.Bool("gitlab-mr-comment"),
+		UploadMinSpeed:      c.Int64("upload-min-speed"),
+		UploadVerifyRetries: c.Int("upload-verify-retries"),
+		Watch:               c.Bool("watch"),
+		WatchDebounce:       c.Duration("watch-debounce"),
+		WatchPoll:           c.Bool("watch-poll"),
+		InsecureHTTP:        c.Bool("insecure-http"),
+		DisableHTTP2:        c.Bool("disable-http2"),
+		SkipTLSVerify:       c.Bool("insecure-skip-tls-verify"),
+		APITimeout:          c.Duration("api-timeout"),
+	}
+
+	if !c.IsSet("deployDir") {
+		if f, ok := detectFramework(filepath.Join(".", cfg.BuildDir)); ok {
+			cfg.Sources = []sourceDir{{dir: filepath.Join(cfg.BuildDir, f.publishDir)}}
+			log.Printf("Detected %s, deploying %s", f.name, cfg.Sources[0].dir)
+		}
+	}
+
+	if len(cfg.Sources) > 0 {
+		cfg.Directory = cfg.Sources[0].dir
+	}
+
+	if cfg.Branch == "" && c.Bool("alias-from-branch") {
+		branch, err := currentBranch()
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Branch = slugifyAlias(branch, cfg.Site)
+		log.Printf("Using alias %s from branch %s", cfg.Branch, branch)
+	}
+
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.PollMaxInterval < cfg.PollInterval {
+		cfg.PollMaxInterval = cfg.PollInterval
+	}
+
+	buildEnv, err := parseBuildEnv(c.StringSlice("build-env"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.BuildEnv = buildEnv
+
+	if c.String("queueSize") == "auto" {
+		cfg.QueueSize = adaptiveMaxUploads
+		cfg.limiter = newAdaptiveLimiter()
+	}
+
+	if err := checkTokenSource(c.String("token-source")); err != nil {
+		return cfg, err
+	}
+
+	if cfg.Token == "" {
+		token, err := readStoredToken(c.String("token-source"))
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Token = token
+	}
+
+	tlsMinVersion, err := parseTLSVersion(c.String("tls-min-version"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.TLSMinVersion = tlsMinVersion
+
+	if caCert := c.String("ca-cert"); caCert != "" {
+		if cfg.RootCAs, err = loadCACert(caCert); err != nil {
+			return cfg, err
+		}
+	}
+
+	if c.IsSet("client-cert") || c.IsSet("client-key") {
+		if c.String("client-cert") == "" || c.String("client-key") == "" {
+			return cfg, fmt.Errorf("--client-cert and --client-key have to be given together")
+		}
+
+		cert, err := tls.LoadX509KeyPair(c.String("client-cert"), c.String("client-key"))
+		if err != nil {
+			return cfg, errors.Wrap(err, "Unable to load the client certificate")
+		}
+		cfg.ClientCerts = []tls.Certificate{cert}
+	}
+
+	if cfg.SkipTLSVerify {
+		log.Print("[WARN] Not verifying tls certificates, anyone between here and netlify can read the token")
+	}
+
+	cfg.rateLimit = &rateLimit{}
+	cfg.httpClient = newHTTPClient(&cfg)
+	cfg.clock = realClock{}
+	cfg.random = rand.Int63n
+	cfg.ctx = c.Context
+
+	cfg.events, err = newEventWriter(c.String("output"), os.Stdout, cfg.clock)
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+func (cfg *config) requireSite() (*netlify.Site, error) {
+	if cfg.Site == "" {
+		return nil, fmt.Errorf("Required flag \"siteName\" not set")
+	}
+
+	if site := cfg.cache.site(cfg.Site); site != nil {
+		return site, nil
 	}
 
 	site, err := cfg.findSite(cfg.Site)
 	if err != nil {
-		return errors.Wrap(err, "Unable to find the site")
+		return nil, errors.Wrap(err, "Unable to find the site")
 	}
 
 	if site == nil {
-		return fmt.Errorf("No site found for %s", cfg.Site)
+		if suggestions := cfg.similarSiteNames(cfg.Site); len(suggestions) > 0 {
+			return nil, fmt.Errorf("%w: no site found for %s, did you mean %s?", ErrSiteNotFound, cfg.Site, strings.Join(suggestions, ", "))
+		}
+		return nil, fmt.Errorf("%w: no site found for %s", ErrSiteNotFound, cfg.Site)
 	}
+	cfg.cache.rememberSite(cfg.Site, site)
 
-	filenameToSha, shaToFilename, err := filesInDirectory(cfg.Directory)
+	return site, nil
+}
+
+func deploy(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Title == "" {
+		// outside of a git repo the deploy is left untitled, as before
+		if title, err := commitTitle(); err == nil {
+			cfg.Title = title
+			log.Printf("Using title %s from git", title)
+		}
+	}
+
+	if cfg.BuildCmd != "" {
+		if err := cfg.runHook("build", cfg.BuildCmd, cfg.BuildDir, cfg.BuildEnv); err != nil {
+			return err
+		}
+	}
 
+	cleanup, err := cfg.prepareSource()
 	if err != nil {
-		return errors.Wrap(err, "Unable to walk directory")
+		return err
+	}
+	defer cleanup()
+
+	if cfg.PreHook != "" {
+		if err := cfg.runHook("pre-hook", cfg.PreHook, "", map[string]string{"DEPLOY_DIR": cfg.Directory}); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Watch {
+		return cfg.watch()
+	}
+
+	sites := cfg.sites()
+	if len(sites) > 1 {
+		return cfg.deployToSites(sites)
+	}
+	if len(sites) == 1 {
+		cfg.Site = sites[0]
+	}
+
+	_, err = cfg.deployAndReport()
+	return err
+}
+
+// deployAndReport runs one deploy and hands the outcome to the ndjson output,
+// tracing and notifiers
+func (cfg *config) deployAndReport() (*deployReport, error) {
+	report := &deployReport{
+		Site:    cfg.Site,
+		Title:   cfg.Title,
+		Message: cfg.Message,
+		Started: cfg.clock.Now(),
+	}
+	cfg.tracer = newTracer(cfg.clock, cfg.httpClient)
+
+	err := cfg.runDeploy(report)
+
+	report.Duration = cfg.clock.Now().Sub(report.Started)
+	report.Err = err
+	report.RateLimitRemaining, report.RateLimitReset, _ = cfg.rateLimit.budget()
+	cfg.events.emitResult(report)
+	log.Print(report.summary())
+	if err := cfg.tracer.finish(report); err != nil {
+		log.Printf("[WARN] Unable to export traces: %v", err)
+	}
+	cfg.notify(report)
+
+	return report, err
+}
+
+func (cfg *config) createDeploy(site *netlify.Site, filenameToSha map[string]string, functions map[string]*functionBundle) (*netlify.Deploy, error) {
+	span := cfg.tracer.start("create_deploy", spanKindClient)
+	if schedules := functionSchedules(functions); len(schedules) > 0 {
+		deploy, err := cfg.createScheduledDeploy(site.ID, filenameToSha, functions, schedules)
+		span.finish(err)
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to create deploy")
+		}
+		span.setAttribute("netlify.deploy_id", deploy.ID)
+		span.setAttribute("netlify.required", len(deploy.Required))
+
+		return deploy, nil
 	}
 
-	deploy, err := netlifyClient().Operations.CreateSiteDeploy(
-		operations.NewCreateSiteDeployParams().WithSiteID(site.ID).WithTitle(&cfg.Title).WithDeploy(&netlify.DeployFiles{
+	deploy, err := cfg.netlifyClient().Operations.CreateSiteDeploy(
+		operations.NewCreateSiteDeployParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID).WithTitle(&cfg.Title).WithDeploy(&netlify.DeployFiles{
 			Async:     true,
 			Branch:    cfg.Branch,
 			Draft:     cfg.Draft,
 			Files:     filenameToSha,
-			Functions: nil,
+			Functions: functionSums(functions),
 		}),
 		authInfo(cfg.Token),
 	)
+	span.finish(err)
+	if err != nil {
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to create deploy")
+	}
+	span.setAttribute("netlify.deploy_id", deploy.GetPayload().ID)
+	span.setAttribute("netlify.required", len(deploy.GetPayload().Required))
+
+	return deploy.GetPayload(), nil
+}
+
+// resumeDeploy picks up a deploy an earlier run created but didn't finish
+// uploading, so only what netlify still needs gets uploaded
+func (cfg *config) resumeDeploy(site *netlify.Site) (*netlify.Deploy, error) {
+	deploy, err := cfg.netlifyClient().Operations.GetDeploy(
+		operations.NewGetDeployParams().WithTimeout(cfg.APITimeout).WithDeployID(cfg.Resume),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to get the deploy to resume")
+	}
+
+	if deploy.GetPayload().SiteID != site.ID {
+		return nil, fmt.Errorf("deploy %s belongs to another site, not %s", cfg.Resume, site.Name)
+	}
+
+	log.Printf("Resuming deploy %s, which is %s", cfg.Resume, deploy.GetPayload().State)
+
+	return deploy.GetPayload(), nil
+}
+
+func (cfg *config) runDeploy(report *deployReport) error {
+	if err := cfg.validateSources(); err != nil {
+		return err
+	}
+
+	span := cfg.tracer.start("find_site", spanKindClient)
+	site, err := cfg.requireSite()
+	span.finish(err)
+	if err != nil {
+		return err
+	}
+
+	hashStart := cfg.clock.Now()
+	span = cfg.tracer.start("hash_files", spanKindInternal)
+	filenameToSha, shaToFilename, err := cfg.collectFiles()
+	span.setAttribute("netlify.files", len(filenameToSha))
+	span.finish(err)
+
+	if err != nil {
+		return err
+	}
+
+	report.HashDuration = cfg.clock.Now().Sub(hashStart)
+	report.FilesHashed = int64(len(filenameToSha))
+
+	for _, source := range cfg.sources() {
+		if source.prefix != "" {
+			continue
+		}
+
+		if err := validateRules(source.dir, filenameToSha, cfg.StrictRules); err != nil {
+			return err
+		}
+	}
+
+	if cfg.PathPrefix != "" {
+		addPathPrefix(cfg.PathPrefix, filenameToSha, shaToFilename)
+
+		if err := cfg.keepPublishedOutsidePrefix(site.ID, cfg.PathPrefix, filenameToSha); err != nil {
+			return err
+		}
+	}
+
+	if err := addEdgeFunctions(cfg.EdgeFunctionsDir, filenameToSha, shaToFilename); err != nil {
+		return err
+	}
+
+	functions, err := cfg.bundleFunctions()
 	if err != nil {
-		return errors.Wrap(err, "Unable to create deploy")
+		return err
 	}
 
-	if deploy.GetPayload().State == "ready" {
-		log.Print("Done deploying site to " + deploy.GetPayload().DeployURL)
+	if cfg.PathPrefix != "" && len(functions) == 0 {
+		log.Printf("[WARN] Published functions aren't carried over when deploying under %s, the site will have none", cfg.PathPrefix)
 	}
 
-	deployID := deploy.GetPayload().ID
+	var deploy *netlify.Deploy
+	if cfg.Resume != "" {
+		deploy, err = cfg.resumeDeploy(site)
+	} else {
+		deploy, err = cfg.createDeploy(site, filenameToSha, functions)
+	}
+	if err != nil {
+		return err
+	}
+
+	if deploy.State == "ready" {
+		log.Print("Done deploying site to " + deploy.DeployURL)
+	}
+
+	deployID := deploy.ID
+	report.DeployID = deployID
+	report.DeployURL = deploy.DeploySslURL
+	report.SiteURL = deploy.SslURL
+	report.AdminURL = deploy.AdminURL
+	if cfg.Branch != "" {
+		report.AliasURL = aliasURL(site, cfg.Branch)
+	}
+	cfg.events.emit(outputEvent{Event: "deploy_created", Site: site.Name, DeployID: deployID, DeployURL: report.DeployURL})
 
 	preparedDeploy, err := cfg.getDeploy(deployID, "prepared")
 	if err != nil {
 		return errors.Wrap(err, "Unable to get deploy")
 	}
 
-	jobChan := make(chan uploadQueueAction, cfg.QueueSize)
+	uploadStart := cfg.clock.Now()
+	uploads, err := requiredUploads(deployID, preparedDeploy.Required, shaToFilename)
+	if err != nil {
+		return err
+	}
 
-	var wg sync.WaitGroup
-	for i := 0; i < cfg.QueueSize; i++ {
-		wg.Add(1)
+	required := map[string]bool{}
+	for _, sha := range preparedDeploy.Required {
+		required[sha] = true
+	}
+	report.FilesRequired = int64(len(uploads))
+	cfg.rateLimit.warnIfExhausting(len(uploads))
 
-		go func() {
-			defer wg.Done()
+	if cfg.ManifestOut != "" {
+		manifest := deployManifest{Site: site.Name, DeployID: deployID, Files: filenameToSha, Required: []string{}}
+		for _, upload := range uploads {
+			manifest.Required = append(manifest.Required, upload.uri)
+		}
 
-			for job := range jobChan {
-				err := job()
-				if err != nil {
-					// FIXME - cancel everthing
-					panic(err)
-				}
-			}
-		}()
+		if err := writeManifest(cfg.ManifestOut, manifest); err != nil {
+			return err
+		}
 	}
 
-	for _, sha := range preparedDeploy.Required {
-		log.Printf("Enqueuing upload of %s", shaToFilename[sha].realfilename)
-		jobChan <- cfg.wrapUploadJob(deployID, shaToFilename[sha].realfilename, shaToFilename[sha].uri)
+	for uri, sha := range filenameToSha {
+		if !matchesAnyGlob(cfg.AlwaysUpload, uri) || required[sha] {
+			continue
+		}
+
+		// files carried over from the published site aren't on disk to upload
+		data := shaFile(shaToFilename, sha, uri)
+		if data == nil {
+			continue
+		}
+
+		log.Printf("Enqueuing forced upload of %s", uri)
+		uploads = append(uploads, pendingUpload{data.realfilename, uri, sha, data.substitute})
 	}
 
-	close(jobChan)
+	var uploadSize int64
+	for _, upload := range uploads {
+		if info, err := os.Stat(upload.realfilename); err == nil {
+			uploadSize += info.Size()
+		}
+	}
+	log.Printf("Netlify already has %d of %d files; uploading %d files (%s)",
+		int64(len(filenameToSha))-report.FilesRequired, len(filenameToSha), len(uploads), humanBytes(uploadSize))
 
-	wg.Wait()
+	if err := cfg.runUploads(cfg.uploadJobs(report, deployID, uploads)); err != nil {
+		return err
+	}
+
+	if err := cfg.ctx.Err(); err != nil {
+		return errors.Wrapf(err, "Interrupted while uploading deploy %s", deployID)
+	}
+
+	if err := cfg.verifyUploads(report, deployID, shaToFilename); err != nil {
+		return err
+	}
+
+	if err := cfg.uploadFunctions(deployID, deploy.RequiredFunctions, functions); err != nil {
+		return err
+	}
+	report.UploadDuration = cfg.clock.Now().Sub(uploadStart)
+
+	if cfg.NoWait {
+		log.Printf("Done uploading deploy %s, not waiting for it to be ready - %s", deployID, deploy.DeployURL)
+		return nil
+	}
 
 	log.Print("Done uploading. Waiting for site to be ready")
 
-	_, err = cfg.getDeploy(deployID, "ready")
+	processingStart := cfg.clock.Now()
+	readyDeploy, err := cfg.getDeploy(deployID, "ready")
+	report.ProcessingDuration = cfg.clock.Now().Sub(processingStart)
 
 	if err != nil {
 		return errors.Wrap(err, "finish deployment")
 	}
 
-	log.Printf("Site is deployed - %s", deploy.GetPayload().DeployURL)
+	cfg.waitForRollout(readyDeploy, filenameToSha)
+
+	log.Printf("Site is deployed - %s", deploy.DeployURL)
+
+	cfg.warmCache(readyDeploy, cfg.warmPaths(filenameToSha, shaToFilename))
+
+	if cfg.PostHook != "" {
+		env := map[string]string{
+			"SITE_NAME":      site.Name,
+			"DEPLOY_ID":      deployID,
+			"DEPLOY_URL":     readyDeploy.DeploySslURL,
+			"DEPLOY_SITE":    readyDeploy.SslURL,
+			"DEPLOY_TITLE":   cfg.Title,
+			"DEPLOY_MESSAGE": cfg.Message,
+		}
+		if err := cfg.runHook("post-hook", cfg.PostHook, "", env); err != nil {
+			return err
+		}
+	}
+
+	if cfg.Open && isInteractive() {
+		if err := openBrowser(readyDeploy.DeploySslURL); err != nil {
+			log.Printf("[WARN] Unable to open a browser: %v", err)
+		}
+	}
 
 	return nil
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir string, name string, content string) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequiredUploadsSharedContent(t *testing.T) {
+	for _, walkers := range []int{1, 4} {
+		dir := t.TempDir()
+		shared := []string{"/index.html", "/about/index.html", "/blog/index.html", "/blog/2020/index.html"}
+		for _, uri := range shared {
+			writeTestFile(t, dir, uri, "<html>same</html>")
+		}
+		writeTestFile(t, dir, "/style.css", "body {}")
+
+		filenameToSha, shaToFilename, err := filesInDirectory(dir, walkers, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sha := filenameToSha["/index.html"]
+		if len(shaToFilename[sha]) != len(shared) {
+			t.Fatalf("walkers=%d: %d paths share %s, want %d", walkers, len(shaToFilename[sha]), sha, len(shared))
+		}
+
+		// netlify lists shared content once in required
+		uploads, err := requiredUploads("deploy", []string{sha}, shaToFilename)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := []string{}
+		for _, upload := range uploads {
+			if upload.sha != sha {
+				t.Errorf("walkers=%d: %s uploaded as %s, want %s", walkers, upload.uri, upload.sha, sha)
+			}
+			if upload.realfilename != filepath.Join(dir, upload.uri) {
+				t.Errorf("walkers=%d: %s read from %s", walkers, upload.uri, upload.realfilename)
+			}
+			got = append(got, upload.uri)
+		}
+
+		sort.Strings(got)
+		want := append([]string{}, shared...)
+		sort.Strings(want)
+		if len(got) != len(want) {
+			t.Fatalf("walkers=%d: uploads %v, want %v", walkers, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("walkers=%d: uploads %v, want %v", walkers, got, want)
+			}
+		}
+	}
+}
+
+func TestRequiredUploadsMissingSha(t *testing.T) {
+	_, shaToFilename, err := filesInDirectory(t.TempDir(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := requiredUploads("deploy", []string{"deadbeef"}, shaToFilename); err == nil {
+		t.Fatal("expected an error for a sha that isn't in deployDir")
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// deployManifest is what --manifest-out writes, everything needed to say
+// exactly which content a deploy shipped
+type deployManifest struct {
+	Site     string            `json:"site"`
+	DeployID string            `json:"deploy_id"`
+	Files    map[string]string `json:"files"`
+	Required []string          `json:"required"`
+}
+
+// writeManifest saves the path to sha map of a deploy along with the paths
+// netlify asked to have uploaded
+func writeManifest(filename string, manifest deployManifest) error {
+	sort.Strings(manifest.Required)
+
+	contents, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(filename, append(contents, '\n'), 0644); err != nil {
+		return errors.Wrap(err, "Unable to write the manifest")
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// pushMetrics sends the report to a prometheus pushgateway in the text
+// exposition format, grouped by site so each site keeps its own last deploy
+func (cfg *config) pushMetrics(report *deployReport) error {
+	success := 1
+	if report.Err != nil {
+		success = 0
+	}
+
+	metrics := []struct {
+		name  string
+		help  string
+		value float64
+	}{
+		{"netlify_deploy_success", "Whether the last deploy succeeded", float64(success)},
+		{"netlify_deploy_files_hashed", "Files hashed in the deploy directory", float64(report.FilesHashed)},
+		{"netlify_deploy_files_uploaded", "Files uploaded to netlify", float64(report.FilesUploaded)},
+		{"netlify_deploy_bytes_uploaded", "Bytes uploaded to netlify", float64(report.BytesUploaded)},
+		{"netlify_deploy_upload_retries", "Upload attempts that had to be retried", float64(report.Retries)},
+		{"netlify_deploy_hash_seconds", "Time spent hashing the deploy directory", report.HashDuration.Seconds()},
+		{"netlify_deploy_upload_seconds", "Time spent uploading files", report.UploadDuration.Seconds()},
+		{"netlify_deploy_processing_seconds", "Time spent waiting for netlify to process the deploy", report.ProcessingDuration.Seconds()},
+		{"netlify_deploy_duration_seconds", "Total time the deploy took", report.Duration.Seconds()},
+		{"netlify_deploy_last_run_timestamp_seconds", "When the deploy started", float64(report.Started.Unix())},
+	}
+
+	var body bytes.Buffer
+	for _, metric := range metrics {
+		fmt.Fprintf(&body, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(&body, "# TYPE %s gauge\n", metric.name)
+		fmt.Fprintf(&body, "%s %g\n", metric.name, metric.value)
+	}
+
+	pushURL := strings.TrimSuffix(cfg.MetricsPushURL, "/") + "/metrics/job/netlify_deploy/site/" + url.PathEscape(report.Site)
+
+	req, err := http.NewRequest(http.MethodPut, pushURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "Unable to push to the pushgateway")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("pushgateway returned %s", resp.Status)
+	}
+
+	return nil
+}
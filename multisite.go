@@ -0,0 +1,120 @@
+package main
+
+import (
+	stderrors "errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// sites is every site to deploy to, --siteName plus --sites with comma
+// separated names split out and duplicates dropped
+func (cfg *config) sites() []string {
+	sites := []string{}
+	seen := map[string]bool{}
+
+	for _, value := range append([]string{cfg.Site}, cfg.Sites...) {
+		for _, site := range strings.Split(value, ",") {
+			site = strings.TrimSpace(site)
+			if site == "" || seen[site] {
+				continue
+			}
+			seen[site] = true
+			sites = append(sites, site)
+		}
+	}
+
+	return sites
+}
+
+// deployToSites runs a deploy pipeline per site at the same time. The
+// directory is hashed once up front so every pipeline reuses the hashes.
+func (cfg *config) deployToSites(sites []string) error {
+	if cfg.cache == nil {
+		cfg.cache = newDaemonCache()
+	}
+
+	for _, source := range cfg.sources() {
+		if _, _, err := filesInDirectory(source.dir, cfg.Walkers, cfg.cache); err != nil {
+			return err
+		}
+	}
+
+	reports := make([]*deployReport, len(sites))
+
+	var wg sync.WaitGroup
+	for i, site := range sites {
+		wg.Add(1)
+
+		go func(i int, site string) {
+			defer wg.Done()
+
+			siteCfg := *cfg
+			siteCfg.Site = site
+			reports[i], _ = siteCfg.deployAndReport()
+		}(i, site)
+	}
+
+	wg.Wait()
+
+	for _, report := range reports {
+		if report.Err != nil {
+			log.Printf("[ERROR] %s failed: %v", report.Site, report.Err)
+			continue
+		}
+
+		log.Printf("%s deployed - %s", report.Site, report.DeployURL)
+	}
+
+	return sitesError(reports)
+}
+
+// sitesError gathers the failed sites' errors into one, or nil when every
+// site deployed
+func sitesError(reports []*deployReport) error {
+	failed := &siteErrors{total: len(reports)}
+	for _, report := range reports {
+		if report.Err != nil {
+			failed.errs = append(failed.errs, fmt.Errorf("%s: %w", report.Site, report.Err))
+		}
+	}
+
+	if len(failed.errs) == 0 {
+		return nil
+	}
+
+	return failed
+}
+
+// siteErrors is the errors of every site that failed to deploy. It is each
+// of them to errors.Is, so when the sites all failed the same way exitCode
+// picks that class, and when they didn't it picks the first class it checks
+// for that any of them has.
+type siteErrors struct {
+	errs  []error
+	total int
+}
+
+func (e *siteErrors) Error() string {
+	messages := []string{}
+	for _, err := range e.errs {
+		messages = append(messages, err.Error())
+	}
+
+	return fmt.Sprintf("%d of %d sites failed: %s", len(e.errs), e.total, strings.Join(messages, "; "))
+}
+
+func (e *siteErrors) Is(target error) bool {
+	for _, err := range e.errs {
+		if stderrors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *siteErrors) Unwrap() []error {
+	return e.errs
+}
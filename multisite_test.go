@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSitesErrorExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		errs []error
+		want int
+	}{
+		{
+			name: "all deployed",
+			errs: []error{nil, nil},
+			want: 0,
+		},
+		{
+			name: "one class",
+			errs: []error{fmt.Errorf("%w: bad token", ErrUnauthorized), nil, ErrUnauthorized},
+			want: exitUnauthorized,
+		},
+		{
+			name: "one class wrapped deeper",
+			errs: []error{fmt.Errorf("Unable to upload file: %w", fmt.Errorf("%w: index.html", ErrUploadFailed))},
+			want: exitUploadFailed,
+		},
+		{
+			name: "mixed classes",
+			errs: []error{ErrWaitTimeout, ErrSiteNotFound},
+			want: exitSiteNotFound,
+		},
+		{
+			name: "unclassified",
+			errs: []error{fmt.Errorf("connection reset"), nil},
+			want: exitFailure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reports := []*deployReport{}
+			for i, err := range tt.errs {
+				reports = append(reports, &deployReport{Site: fmt.Sprintf("site-%d", i), Err: err})
+			}
+
+			err := sitesError(reports)
+			if tt.want == 0 {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				return
+			}
+
+			if got := exitCode(err); got != tt.want {
+				t.Errorf("exit code %d for %v, want %d", got, err, tt.want)
+			}
+		})
+	}
+}
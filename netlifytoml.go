@@ -0,0 +1,648 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+)
+
+// netlifyConfig is the part of netlify.toml this tool reads, table name (like
+// functions or functions.api) to key to value. Values are strings, bools,
+// int64s, float64s or []interface{} of those.
+type netlifyConfig map[string]map[string]interface{}
+
+// readTables lists the tables of netlify.toml that are read, everything else
+// (redirects, headers, plugins, contexts) is left for netlify to handle
+var readTables = []string{"build", "functions"}
+
+// readNetlifyConfig reads netlify.toml from dir, an empty config if there is
+// none
+func readNetlifyConfig(dir string) (netlifyConfig, error) {
+	path := filepath.Join(dir, "netlify.toml")
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return netlifyConfig{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read netlify.toml")
+	}
+	defer f.Close()
+
+	config, err := parseNetlifyConfig(f)
+	return config, errors.Wrapf(err, "Unable to parse %s", path)
+}
+
+// parseNetlifyConfig reads the build and functions tables of netlify.toml.
+// The whole file is tokenised so multi-line strings, arrays and inline tables
+// anywhere in it are stepped over correctly, but only the keys in readTables
+// are kept. A value this reader doesn't understand is skipped rather than
+// failing the deploy, netlify validates the file itself; only a file that
+// can't be tokenised at all (an unterminated string, say) is an error.
+func parseNetlifyConfig(r io.Reader) (netlifyConfig, error) {
+	text, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &tomlParser{text: strings.ReplaceAll(string(text), "\r\n", "\n"), line: 1}
+	config := netlifyConfig{}
+	var table []string
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return config, nil
+		}
+
+		if p.peek() == '[' {
+			name, err := p.header()
+			if err != nil {
+				return nil, p.errorf("%v", err)
+			}
+			table = name
+			if err := p.endOfLine(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		line := p.line
+		keyParts, err := p.key()
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+
+		p.skipSpace()
+		if p.eof() || p.peek() != '=' {
+			return nil, p.errorf("expected key = value")
+		}
+		p.pos++
+		p.skipSpace()
+
+		value, err := p.value()
+		if _, ok := err.(tomlUnsupportedError); ok {
+			log.Printf("[DEBUG] netlify.toml line %d: ignoring %v", line, err)
+			p.skipLine()
+			continue
+		}
+		if err != nil {
+			return nil, p.errorf("%v", err)
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+
+		// array tables ([[redirects]] and friends) are never read
+		if table != nil && isReadTable(strings.Join(table, ".")) {
+			config.set(append(append([]string{}, table...), keyParts...), value)
+		}
+	}
+}
+
+// set stores value at the dotted path, with inline tables spread out into
+// tables of their own as if they had been written as [table] headers
+func (c netlifyConfig) set(path []string, value interface{}) {
+	if inline, ok := value.(map[string]interface{}); ok {
+		for key, v := range inline {
+			c.set(append(append([]string{}, path...), key), v)
+		}
+		return
+	}
+
+	name := strings.Join(path[:len(path)-1], ".")
+	if c[name] == nil {
+		c[name] = map[string]interface{}{}
+	}
+	c[name][path[len(path)-1]] = value
+}
+
+func isReadTable(table string) bool {
+	for _, name := range readTables {
+		if table == name || strings.HasPrefix(table, name+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tomlUnsupportedError is a value that is valid toml, or may be, but that
+// this reader doesn't decode
+type tomlUnsupportedError struct {
+	value string
+}
+
+func (e tomlUnsupportedError) Error() string {
+	return fmt.Sprintf("unsupported value %q", e.value)
+}
+
+// tomlParser walks netlify.toml one token at a time
+type tomlParser struct {
+	text string
+	pos  int
+	line int
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.text)
+}
+
+func (p *tomlParser) peek() byte {
+	return p.text[p.pos]
+}
+
+func (p *tomlParser) rest() string {
+	return p.text[p.pos:]
+}
+
+func (p *tomlParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: "+format, append([]interface{}{p.line}, args...)...)
+}
+
+// advance moves past n bytes, counting the newlines in them
+func (p *tomlParser) advance(n int) {
+	p.line += strings.Count(p.text[p.pos:p.pos+n], "\n")
+	p.pos += n
+}
+
+// skipSpace skips spaces and tabs, staying on the line
+func (p *tomlParser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+// skipBlank skips whitespace, newlines and comments
+func (p *tomlParser) skipBlank() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t', '\n':
+			p.advance(1)
+		case '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+// skipLine moves to the start of the next line
+func (p *tomlParser) skipLine() {
+	end := strings.IndexByte(p.rest(), '\n')
+	if end < 0 {
+		p.pos = len(p.text)
+		return
+	}
+	p.advance(end + 1)
+}
+
+// endOfLine checks only a comment is left on the line and moves past it
+func (p *tomlParser) endOfLine() error {
+	p.skipSpace()
+	if p.eof() {
+		return nil
+	}
+
+	switch p.peek() {
+	case '\n':
+		p.advance(1)
+	case '#':
+		p.skipLine()
+	default:
+		return p.errorf("unexpected %q", firstLine(p.rest()))
+	}
+
+	return nil
+}
+
+// header reads a [table] or [[array table]] header. Array tables come back as
+// nil as nothing in them is read.
+func (p *tomlParser) header() ([]string, error) {
+	array := strings.HasPrefix(p.rest(), "[[")
+	open, close := "[", "]"
+	if array {
+		open, close = "[[", "]]"
+	}
+	p.advance(len(open))
+	p.skipSpace()
+
+	parts, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+	if !strings.HasPrefix(p.rest(), close) {
+		return nil, fmt.Errorf("expected %s to close the table header", close)
+	}
+	p.advance(len(close))
+
+	if array {
+		return nil, nil
+	}
+	return parts, nil
+}
+
+// key reads a dotted key of bare and quoted parts
+func (p *tomlParser) key() ([]string, error) {
+	parts := []string{}
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return nil, fmt.Errorf("expected a key")
+		}
+
+		switch c := p.peek(); {
+		case c == '"':
+			s, err := p.basicString()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, s)
+		case c == '\'':
+			s, err := p.literalString()
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, s)
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if start == p.pos {
+				return nil, fmt.Errorf("expected a key, found %q", firstLine(p.rest()))
+			}
+			parts = append(parts, p.text[start:p.pos])
+		}
+
+		p.skipSpace()
+		if p.eof() || p.peek() != '.' {
+			return parts, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// value reads any value, leaving the position just after it
+func (p *tomlParser) value() (interface{}, error) {
+	if p.eof() {
+		return nil, fmt.Errorf("expected a value")
+	}
+
+	rest := p.rest()
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return p.multilineBasicString()
+	case strings.HasPrefix(rest, "'''"):
+		return p.multilineLiteralString()
+	case rest[0] == '"':
+		return p.basicString()
+	case rest[0] == '\'':
+		return p.literalString()
+	case rest[0] == '[':
+		return p.array()
+	case rest[0] == '{':
+		return p.inlineTable()
+	}
+
+	return p.scalar()
+}
+
+func (p *tomlParser) basicString() (string, error) {
+	end := 1
+	for end < len(p.rest()) && p.rest()[end] != '"' && p.rest()[end] != '\n' {
+		if p.rest()[end] == '\\' {
+			end++
+		}
+		end++
+	}
+	if end >= len(p.rest()) || p.rest()[end] != '"' {
+		return "", fmt.Errorf("unterminated string")
+	}
+
+	s, err := unescapeToml(p.rest()[1:end])
+	p.advance(end + 1)
+	return s, err
+}
+
+func (p *tomlParser) literalString() (string, error) {
+	end := strings.IndexAny(p.rest()[1:], "'\n")
+	if end < 0 || p.rest()[1+end] != '\'' {
+		return "", fmt.Errorf("unterminated string")
+	}
+
+	s := p.rest()[1 : 1+end]
+	p.advance(end + 2)
+	return s, nil
+}
+
+func (p *tomlParser) multilineBasicString() (string, error) {
+	body := p.rest()[3:]
+	end := 0
+	for {
+		i := strings.Index(body[end:], `"""`)
+		if i < 0 {
+			return "", fmt.Errorf("unterminated multi-line string")
+		}
+		end += i
+		if !escapedAt(body, end) {
+			break
+		}
+		end++
+	}
+	// up to two quotes right before the closing ones belong to the string
+	for end+3 < len(body) && body[end+3] == '"' {
+		end++
+	}
+
+	raw := strings.TrimPrefix(body[:end], "\n")
+	// a backslash at the end of a line joins it with the next non blank text
+	raw = tomlLineContinuation.ReplaceAllString(raw, "")
+	s, err := unescapeToml(raw)
+	p.advance(3 + end + 3)
+	return s, err
+}
+
+func (p *tomlParser) multilineLiteralString() (string, error) {
+	body := p.rest()[3:]
+	end := strings.Index(body, "'''")
+	if end < 0 {
+		return "", fmt.Errorf("unterminated multi-line string")
+	}
+	for end+3 < len(body) && body[end+3] == '\'' {
+		end++
+	}
+
+	s := strings.TrimPrefix(body[:end], "\n")
+	p.advance(3 + end + 3)
+	return s, nil
+}
+
+var tomlLineContinuation = regexp.MustCompile(`\\[ \t]*\n[ \t\n]*`)
+
+// escapedAt reports if the byte at i is preceded by an odd number of
+// backslashes
+func escapedAt(s string, i int) bool {
+	backslashes := 0
+	for j := i - 1; j >= 0 && s[j] == '\\'; j-- {
+		backslashes++
+	}
+	return backslashes%2 == 1
+}
+
+// unescapeToml expands the escapes of a basic string
+func unescapeToml(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			out.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if i >= len(s) {
+			return "", fmt.Errorf("trailing backslash in string")
+		}
+
+		switch s[i] {
+		case 'b':
+			out.WriteByte('\b')
+		case 't':
+			out.WriteByte('\t')
+		case 'n':
+			out.WriteByte('\n')
+		case 'f':
+			out.WriteByte('\f')
+		case 'r':
+			out.WriteByte('\r')
+		case 'e':
+			out.WriteByte(0x1b)
+		case '"', '\\':
+			out.WriteByte(s[i])
+		case 'u', 'U':
+			size := 4
+			if s[i] == 'U' {
+				size = 8
+			}
+			if i+size >= len(s) {
+				return "", fmt.Errorf("short unicode escape in string")
+			}
+			code, err := strconv.ParseUint(s[i+1:i+1+size], 16, 32)
+			if err != nil || !utf8.ValidRune(rune(code)) {
+				return "", fmt.Errorf("invalid unicode escape in string")
+			}
+			out.WriteRune(rune(code))
+			i += size
+		default:
+			return "", fmt.Errorf("invalid escape \\%c in string", s[i])
+		}
+	}
+
+	return out.String(), nil
+}
+
+// array reads [ values ], which may span lines and have comments and a
+// trailing comma
+func (p *tomlParser) array() (interface{}, error) {
+	p.advance(1)
+	values := []interface{}{}
+	var unsupported error
+
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return nil, fmt.Errorf("unterminated array")
+		}
+		if p.peek() == ']' {
+			p.advance(1)
+			// an array is only as usable as its least usable value
+			if unsupported != nil {
+				return nil, unsupported
+			}
+			return values, nil
+		}
+
+		value, err := p.value()
+		if _, ok := err.(tomlUnsupportedError); ok && unsupported == nil {
+			unsupported = err
+		} else if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+
+		p.skipBlank()
+		if !p.eof() && p.peek() == ',' {
+			p.advance(1)
+		} else if p.eof() || p.peek() != ']' {
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// inlineTable reads { key = value, ... } on one line
+func (p *tomlParser) inlineTable() (interface{}, error) {
+	p.advance(1)
+	table := map[string]interface{}{}
+	var unsupported error
+
+	for {
+		p.skipSpace()
+		if p.eof() || p.peek() == '\n' {
+			return nil, fmt.Errorf("unterminated inline table")
+		}
+		if p.peek() == '}' {
+			p.advance(1)
+			if unsupported != nil {
+				return nil, unsupported
+			}
+			return table, nil
+		}
+
+		parts, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if p.eof() || p.peek() != '=' {
+			return nil, fmt.Errorf("expected key = value in inline table")
+		}
+		p.advance(1)
+		p.skipSpace()
+
+		value, err := p.value()
+		if _, ok := err.(tomlUnsupportedError); ok && unsupported == nil {
+			unsupported = err
+		} else if err != nil {
+			return nil, err
+		}
+
+		nested := table
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := nested[part].(map[string]interface{})
+			if !ok {
+				next = map[string]interface{}{}
+				nested[part] = next
+			}
+			nested = next
+		}
+		nested[parts[len(parts)-1]] = value
+
+		p.skipSpace()
+		if !p.eof() && p.peek() == ',' {
+			p.advance(1)
+		} else if p.eof() || p.peek() != '}' {
+			return nil, fmt.Errorf("expected , or } in inline table")
+		}
+	}
+}
+
+// tomlDateTime matches the dates, times and date-times toml allows, which are
+// kept as the text they were written as
+var tomlDateTime = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})?)?|\d{2}:\d{2}(:\d{2}(\.\d+)?)?)`)
+
+// scalar reads a bool, number or date
+func (p *tomlParser) scalar() (interface{}, error) {
+	if date := tomlDateTime.FindString(p.rest()); date != "" {
+		p.advance(len(date))
+		return date, nil
+	}
+
+	end := strings.IndexAny(p.rest(), " \t\n,]}#")
+	if end < 0 {
+		end = len(p.rest())
+	}
+	token := p.rest()[:end]
+	if token == "" {
+		return nil, fmt.Errorf("expected a value, found %q", firstLine(p.rest()))
+	}
+	p.advance(end)
+
+	switch token {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "inf", "+inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan", "+nan", "-nan":
+		return math.NaN(), nil
+	}
+
+	number := strings.ReplaceAll(token, "_", "")
+	for prefix, base := range map[string]int{"0x": 16, "0o": 8, "0b": 2} {
+		if strings.HasPrefix(number, prefix) {
+			if n, err := strconv.ParseInt(number[2:], base, 64); err == nil {
+				return n, nil
+			}
+		}
+	}
+	if tomlInteger.MatchString(number) {
+		if n, err := strconv.ParseInt(number, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	if tomlFloat.MatchString(number) {
+		if f, err := strconv.ParseFloat(number, 64); err == nil {
+			return f, nil
+		}
+	}
+
+	return nil, tomlUnsupportedError{token}
+}
+
+var (
+	tomlInteger = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+	tomlFloat   = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+)
+
+// firstLine is s up to its first newline, for error messages
+func firstLine(s string) string {
+	if end := strings.IndexByte(s, '\n'); end >= 0 {
+		return s[:end]
+	}
+	return s
+}
+
+// stringValue is a config value as a string, "" if it isn't one
+func (c netlifyConfig) stringValue(table string, key string) string {
+	s, _ := c[table][key].(string)
+	return s
+}
+
+// stringsValue is a config value as a list of strings, a lone string is a
+// list of one
+func (c netlifyConfig) stringsValue(table string, key string) []string {
+	switch value := c[table][key].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, v := range value {
+			values = append(values, fmt.Sprint(v))
+		}
+		return values
+	}
+
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseNetlifyConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		toml string
+		want netlifyConfig
+	}{
+		{
+			name: "functions and build",
+			toml: `
+[build]
+  command = "npm run build"
+  publish = "dist"
+  functions = "netlify/functions"
+
+[functions]
+  node_bundler = "esbuild"
+  included_files = ["data/**", "!data/drafts/**"]
+`,
+			want: netlifyConfig{
+				"build": {"command": "npm run build", "publish": "dist", "functions": "netlify/functions"},
+				"functions": {
+					"node_bundler":   "esbuild",
+					"included_files": []interface{}{"data/**", "!data/drafts/**"},
+				},
+			},
+		},
+		{
+			name: "redirects and headers are stepped over",
+			toml: `
+[build]
+  publish = "public"
+
+[[redirects]]
+  from = "/api/*"
+  to = "/.netlify/functions/:splat"
+  status = 200
+  force = true
+  headers = {X-From = "Netlify", "X-Robots-Tag" = "noindex"}
+  conditions = {Language = ["en", "de"], Role = ["admin"]}
+
+[[headers]]
+  for = "/*"
+  [headers.values]
+    Content-Security-Policy = """
+      default-src 'self';
+      script-src 'self' https://example.com;
+      [functions]
+      """
+    X-Frame-Options = "DENY"
+
+[functions]
+  directory = "lambda"
+`,
+			want: netlifyConfig{
+				"build":     {"publish": "public"},
+				"functions": {"directory": "lambda"},
+			},
+		},
+		{
+			name: "contexts, plugins and dev",
+			toml: `
+[build]
+  base = "site/"
+  command = "hugo --gc --minify"
+
+[build.environment]
+  HUGO_VERSION = "0.119.0"
+  NODE_VERSION = '18'
+
+[build.processing.css]
+  bundle = false
+  minify = true
+
+[context.production.environment]
+  HUGO_ENV = "production"
+
+[context.deploy-preview]
+  command = "hugo --buildFuture -b $DEPLOY_PRIME_URL"
+
+[[plugins]]
+  package = "@netlify/plugin-lighthouse"
+  [plugins.inputs.thresholds]
+    performance = 0.9
+    accessibility = 0.9
+
+[dev]
+  port = 8888
+  targetPort = 1_313
+  framework = "#custom"
+  publish = 'public'  # comment after a value
+`,
+			want: netlifyConfig{
+				"build":                {"base": "site/", "command": "hugo --gc --minify"},
+				"build.environment":    {"HUGO_VERSION": "0.119.0", "NODE_VERSION": "18"},
+				"build.processing.css": {"bundle": false, "minify": true},
+			},
+		},
+		{
+			name: "per function tables",
+			toml: `
+[functions]
+  external_node_modules = [
+    "sharp", # native
+    "canvas",
+  ]
+
+[functions."api_*"]
+  node_bundler = "zisi"
+
+[functions.cleanup]
+  schedule = "@daily"
+
+[functions."v2.api"]
+  included_files = ['data/*.json']
+`,
+			want: netlifyConfig{
+				"functions":         {"external_node_modules": []interface{}{"sharp", "canvas"}},
+				"functions.api_*":   {"node_bundler": "zisi"},
+				"functions.cleanup": {"schedule": "@daily"},
+				"functions.v2.api":  {"included_files": []interface{}{"data/*.json"}},
+			},
+		},
+		{
+			name: "inline tables and dotted keys in read tables",
+			toml: `
+[functions]
+  api = { node_bundler = "esbuild", included_files = ["a"] }
+  worker.schedule = "@hourly"
+  timeout = 26.5
+  released = 2023-10-01T12:00:00Z
+  banner = '''
+it's raw \n'''
+  escaped = "tab\tquote\" é"
+`,
+			want: netlifyConfig{
+				"functions": {
+					"timeout":  26.5,
+					"released": "2023-10-01T12:00:00Z",
+					"banner":   "it's raw \\n",
+					"escaped":  "tab\tquote\" é",
+				},
+				"functions.api":    {"node_bundler": "esbuild", "included_files": []interface{}{"a"}},
+				"functions.worker": {"schedule": "@hourly"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNetlifyConfig(strings.NewReader(tt.toml))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNetlifyConfigErrors(t *testing.T) {
+	tests := []string{
+		"[build]\ncommand = \"unterminated\n",
+		"[build]\ncommand = \"\"\"never closed\n",
+		"[build\ncommand = \"x\"\n",
+		"[build]\ncommand \"x\"\n",
+		"[build]\nlist = [1, 2\n",
+	}
+
+	for _, toml := range tests {
+		if _, err := parseNetlifyConfig(strings.NewReader(toml)); err == nil {
+			t.Errorf("expected an error parsing %q", toml)
+		}
+	}
+}
+
+func TestParseNetlifyConfigSkipsUnknownValues(t *testing.T) {
+	toml := `
+[build]
+  command = make
+  publish = "dist"
+`
+
+	got, err := parseNetlifyConfig(strings.NewReader(toml))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.stringValue("build", "publish") != "dist" {
+		t.Errorf("got %#v, want publish kept after the unknown value", got)
+	}
+}
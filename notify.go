@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// deployReport is what a deploy run did, handed to the notifiers when it ends.
+// The counters are first so they stay 64 bit aligned for sync/atomic on 32 bit
+// platforms.
+type deployReport struct {
+	FilesHashed   int64
+	FilesRequired int64
+	FilesUploaded int64
+	BytesUploaded int64
+	Retries       int64
+
+	// RateLimitReset is zero when netlify didn't send rate limit headers
+	RateLimitRemaining int64
+	RateLimitReset     time.Time
+
+	HashDuration       time.Duration
+	UploadDuration     time.Duration
+	ProcessingDuration time.Duration
+
+	Site      string
+	Title     string
+	Message   string
+	DeployID  string
+	DeployURL string
+	SiteURL   string
+	AdminURL  string
+	AliasURL  string
+	Started   time.Time
+	Duration  time.Duration
+	Err       error
+}
+
+// notify tells every configured integration how the deploy went. Failing to
+// notify is logged but never fails the deploy itself.
+func (cfg *config) notify(report *deployReport) {
+	if cfg.SlackWebhook != "" {
+		if err := cfg.notifySlack(report); err != nil {
+			log.Printf("[WARN] Unable to notify slack: %v", err)
+		}
+	}
+
+	if cfg.GitHubPRComment {
+		if err := cfg.commentOnGitHub(report); err != nil {
+			log.Printf("[WARN] Unable to comment on the pull request: %v", err)
+		}
+	}
+
+	if cfg.GitLabMRComment {
+		if err := cfg.commentOnGitLab(report); err != nil {
+			log.Printf("[WARN] Unable to comment on the merge request: %v", err)
+		}
+	}
+
+	if cfg.MetricsPushURL != "" {
+		if err := cfg.pushMetrics(report); err != nil {
+			log.Printf("[WARN] Unable to push metrics: %v", err)
+		}
+	}
+}
+
+func (cfg *config) notifySlack(report *deployReport) error {
+	text := fmt.Sprintf(":white_check_mark: Deployed *%s* in %s\n%s", report.Site, report.Duration.Round(time.Second), report.DeployURL)
+	if report.Message != "" {
+		text += "\n" + report.Message
+	}
+	if report.Err != nil {
+		text = fmt.Sprintf(":x: Deploy of *%s* failed after %s\n%v", report.Site, report.Duration.Round(time.Second), report.Err)
+		if report.DeployID != "" {
+			text += "\ndeploy id " + report.DeployID
+		}
+	}
+
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	resp, err := cfg.httpClient.Post(cfg.SlackWebhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "Unable to post to slack")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("slack returned %s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// outputSchemaVersion is the version of the --output ndjson events. Adding a
+// field or a new event type is backwards compatible and does not change it,
+// so consumers must ignore fields and events they don't know about. Removing
+// or renaming a field, or changing what one means, bumps it.
+const outputSchemaVersion = 1
+
+// outputEvent is one line of --output ndjson. Fields only used by some events
+// are omitted when empty.
+type outputEvent struct {
+	SchemaVersion int       `json:"schema_version"`
+	Event         string    `json:"event"`
+	Time          time.Time `json:"time"`
+
+	Site      string `json:"site,omitempty"`
+	DeployID  string `json:"deploy_id,omitempty"`
+	DeployURL string `json:"deploy_url,omitempty"`
+	State     string `json:"state,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Sha       string `json:"sha,omitempty"`
+	Bytes     int64  `json:"bytes,omitempty"`
+
+	Result *outputResult `json:"result,omitempty"`
+}
+
+// outputResult is the summary carried by the final "result" event
+type outputResult struct {
+	Success           bool    `json:"success"`
+	Error             string  `json:"error,omitempty"`
+	FilesHashed       int64   `json:"files_hashed"`
+	FilesUploaded     int64   `json:"files_uploaded"`
+	BytesUploaded     int64   `json:"bytes_uploaded"`
+	Retries           int64   `json:"retries"`
+	DurationSeconds   float64 `json:"duration_seconds"`
+	HashSeconds       float64 `json:"hash_seconds"`
+	UploadSeconds     float64 `json:"upload_seconds"`
+	ProcessingSeconds float64 `json:"processing_seconds"`
+	SiteURL           string  `json:"site_url,omitempty"`
+	AdminURL          string  `json:"admin_url,omitempty"`
+	AliasURL          string  `json:"alias_url,omitempty"`
+	Title             string  `json:"title,omitempty"`
+	Message           string  `json:"message,omitempty"`
+}
+
+// eventWriter writes outputEvents as newline delimited json. Uploads run in
+// parallel so writes are serialised. A nil eventWriter drops everything, which
+// is what the default text output uses.
+type eventWriter struct {
+	mu    sync.Mutex
+	out   io.Writer
+	clock clock
+}
+
+func newEventWriter(format string, out io.Writer, clock clock) (*eventWriter, error) {
+	switch format {
+	case "", "text":
+		return nil, nil
+	case "ndjson":
+		return &eventWriter{out: out, clock: clock}, nil
+	default:
+		return nil, fmt.Errorf("Unknown output %s, expected text or ndjson", format)
+	}
+}
+
+func (w *eventWriter) emit(event outputEvent) {
+	if w == nil {
+		return
+	}
+
+	event.SchemaVersion = outputSchemaVersion
+	event.Time = w.clock.Now().UTC()
+
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.out.Write(append(line, '\n'))
+}
+
+// emitResult writes the final event of a deploy from its report
+func (w *eventWriter) emitResult(report *deployReport) {
+	if w == nil {
+		return
+	}
+
+	result := &outputResult{
+		Success:           report.Err == nil,
+		FilesHashed:       report.FilesHashed,
+		FilesUploaded:     report.FilesUploaded,
+		BytesUploaded:     report.BytesUploaded,
+		Retries:           report.Retries,
+		DurationSeconds:   report.Duration.Seconds(),
+		HashSeconds:       report.HashDuration.Seconds(),
+		UploadSeconds:     report.UploadDuration.Seconds(),
+		ProcessingSeconds: report.ProcessingDuration.Seconds(),
+		SiteURL:           report.SiteURL,
+		AdminURL:          report.AdminURL,
+		AliasURL:          report.AliasURL,
+		Title:             report.Title,
+		Message:           report.Message,
+	}
+	if report.Err != nil {
+		result.Error = report.Err.Error()
+	}
+
+	w.emit(outputEvent{
+		Event:     "result",
+		Site:      report.Site,
+		DeployID:  report.DeployID,
+		DeployURL: report.DeployURL,
+		Result:    result,
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// defaultMaxFileSize is the size above which files are warned about, netlify
+// rejects very large files part way through the upload
+const defaultMaxFileSize = 100 * 1024 * 1024
+
+// findOversizedFiles returns the size of every file over limit bytes
+func findOversizedFiles(dir string, filenameToSha map[string]string, limit int64) map[string]int64 {
+	oversized := map[string]int64{}
+	if limit <= 0 {
+		return oversized
+	}
+
+	for uri := range filenameToSha {
+		info, err := os.Stat(filepath.Join(dir, uri))
+		if err == nil && info.Size() > limit {
+			oversized[uri] = info.Size()
+		}
+	}
+
+	return oversized
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// checkOversizedFiles warns about every file over the limit, or with skip
+// leaves them out of the deploy entirely
+func checkOversizedFiles(dir string, filenameToSha map[string]string, shaToFilename map[string][]*shaData, limit int64, skip bool) {
+	oversized := findOversizedFiles(dir, filenameToSha, limit)
+
+	uris := []string{}
+	for uri := range oversized {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		if !skip {
+			log.Printf("[WARN] %s is %s, over the %s limit, netlify may reject it (--skip-oversized leaves it out)", uri, humanBytes(oversized[uri]), humanBytes(limit))
+			continue
+		}
+
+		log.Printf("[WARN] Skipping %s, it is %s which is over the %s limit", uri, humanBytes(oversized[uri]), humanBytes(limit))
+
+		removeShaFile(shaToFilename, filenameToSha[uri], uri)
+		delete(filenameToSha, uri)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"path"
+	"strings"
+)
+
+// normalizePathPrefix makes --path-prefix /docs, docs/ and /docs/ all mean
+// /docs, and / or "" mean no prefix
+func normalizePathPrefix(prefix string) string {
+	prefix = path.Clean("/" + prefix)
+	if prefix == "/" {
+		return ""
+	}
+
+	return prefix
+}
+
+// addPathPrefix moves every file of the deploy under prefix
+func addPathPrefix(prefix string, filenameToSha map[string]string, shaToFilename map[string][]*shaData) {
+	for uri := range unservedFiles {
+		if _, ok := filenameToSha[uri]; ok {
+			log.Printf("[WARN] %s only works at the root of a site, under %s netlify will serve it as a plain file", uri, prefix)
+		}
+	}
+
+	uris := make([]string, 0, len(filenameToSha))
+	for uri := range filenameToSha {
+		uris = append(uris, uri)
+	}
+
+	for _, uri := range uris {
+		filenameToSha[prefix+uri] = filenameToSha[uri]
+		delete(filenameToSha, uri)
+	}
+
+	for _, files := range shaToFilename {
+		for _, data := range files {
+			data.uri = prefix + data.uri
+		}
+	}
+}
+
+// keepPublishedOutsidePrefix adds the published files that aren't under
+// prefix to the deploy. A deploy always replaces the whole site, so without
+// them deploying under a prefix would take everything else down. They are
+// already on netlify so are never uploaded again.
+func (cfg *config) keepPublishedOutsidePrefix(siteID string, prefix string, filenameToSha map[string]string) error {
+	published, err := cfg.publishedFiles(siteID)
+	if err != nil {
+		return err
+	}
+
+	kept := 0
+	for uri, sha := range published {
+		if uri == prefix || strings.HasPrefix(uri, prefix+"/") {
+			continue
+		}
+
+		filenameToSha[uri] = sha
+		kept++
+	}
+
+	log.Printf("Deploying under %s, keeping %d published files outside of it", prefix, kept)
+
+	return nil
+}
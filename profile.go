@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultProfile is used when --profile isn't given, if the file has one
+const defaultProfile = "default"
+
+// profileFile is the config.yaml next to the stored login token, a map of
+// profile names to flag values:
+//
+//	profiles:
+//	  staging:
+//	    siteName: my-site-staging
+//	    deployDir: public
+//	    always-upload: [/sw.js]
+type profileFile struct {
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+func profilePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to find the config directory")
+	}
+
+	return filepath.Join(dir, "netlify-deploy", "config.yaml"), nil
+}
+
+// applyProfile fills in every flag the selected profile sets that wasn't
+// given on the command line or in the environment
+func applyProfile(c *cli.Context) error {
+	path, err := profilePath()
+	if err != nil {
+		return err
+	}
+
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if c.IsSet("profile") {
+			return fmt.Errorf("--profile %s given but there is no %s", c.String("profile"), path)
+		}
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "Unable to read profiles")
+	}
+
+	file := profileFile{}
+	if err := yaml.Unmarshal(contents, &file); err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", path)
+	}
+
+	name := c.String("profile")
+	profile, ok := file.Profiles[name]
+	if !ok {
+		if c.IsSet("profile") {
+			return fmt.Errorf("No profile %s in %s", name, path)
+		}
+		return nil
+	}
+
+	return setFlagValues(c, profile, "Profile "+name)
+}
+
+// applyConfigFile fills in every flag --config sets that wasn't given on the
+// command line or in the environment. It goes before the profile, the file
+// checked in with the site knows more about the deploy than a profile does.
+//
+//	siteName: my-site
+//	deployDir: public
+//	always-upload: [/sw.js]
+//	post-hook: ./scripts/notify.sh
+func applyConfigFile(c *cli.Context) error {
+	path := c.String("config")
+	if path == "" {
+		return nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "Unable to read config")
+	}
+
+	values := map[string]interface{}{}
+	if err := yaml.Unmarshal(contents, &values); err != nil {
+		return errors.Wrapf(err, "Unable to parse %s", path)
+	}
+
+	return setFlagValues(c, values, path)
+}
+
+// applyFlagFiles is the app's Before, flags and environment variables win
+// over --config which wins over the profile
+func applyFlagFiles(c *cli.Context) error {
+	if err := applyConfigFile(c); err != nil {
+		return err
+	}
+
+	return applyProfile(c)
+}
+
+var configVariable = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandConfigValue replaces ${VAR} with the environment variable's value.
+// Only the braced form is expanded so a lone $ in a value is left alone.
+// Undefined variables expand to nothing, or are an error when strict.
+func expandConfigValue(value string, strict bool) (string, error) {
+	var undefined []string
+
+	expanded := configVariable.ReplaceAllStringFunc(value, func(ref string) string {
+		name := configVariable.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			undefined = append(undefined, name)
+		}
+		return v
+	})
+
+	if strict && len(undefined) > 0 {
+		return "", fmt.Errorf("%s is not set", strings.Join(undefined, ", "))
+	}
+
+	return expanded, nil
+}
+
+// setFlagValues sets each flag in values that isn't already set, lists set
+// the flag once per item
+func setFlagValues(c *cli.Context, values map[string]interface{}, source string) error {
+	for flag, value := range values {
+		if c.IsSet(flag) {
+			continue
+		}
+
+		items, isList := value.([]interface{})
+		if !isList {
+			items = []interface{}{value}
+		}
+
+		for _, v := range items {
+			expanded, err := expandConfigValue(fmt.Sprint(v), c.Bool("config-strict-env"))
+			if err != nil {
+				return errors.Wrapf(err, "%s has a bad %s", source, flag)
+			}
+
+			if err := c.Set(flag, expanded); err != nil {
+				return errors.Wrapf(err, "%s has a bad %s", source, flag)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+// promote publishes a previously created (usually draft) deploy to production
+// without uploading anything again.
+func promote(c *cli.Context) error {
+	deployID := c.Args().First()
+	if deployID == "" {
+		return fmt.Errorf("promote requires a deploy id")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	restored, err := cfg.netlifyClient().Operations.RestoreSiteDeploy(
+		operations.NewRestoreSiteDeployParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID).WithDeployID(deployID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to promote deploy")
+	}
+
+	log.Printf("Deploy %s is now published - %s", restored.GetPayload().ID, site.SslURL)
+
+	return nil
+}
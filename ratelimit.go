@@ -0,0 +1,97 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimit is the api request budget netlify last reported in its
+// X-RateLimit headers. A nil rateLimit tracks nothing.
+type rateLimit struct {
+	mu        sync.Mutex
+	known     bool
+	limit     int64
+	remaining int64
+	reset     time.Time
+}
+
+// record reads the rate limit headers off an api response, if it has them
+func (r *rateLimit) record(resp *http.Response) {
+	if r == nil {
+		return
+	}
+
+	remaining, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Remaining"), 10, 64)
+	if err != nil {
+		return
+	}
+	limit, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Limit"), 10, 64)
+	reset, _ := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	first := !r.known
+	wasLow := r.low()
+
+	r.known = true
+	r.remaining = remaining
+	r.limit = limit
+	if reset > 0 {
+		r.reset = time.Unix(reset, 0)
+	}
+
+	// every upload is a request, so only log the first reading and running low
+	switch {
+	case first:
+		log.Printf("[DEBUG] %d of %d api requests left until %s", remaining, limit, r.reset.Format(time.RFC3339))
+	case r.low() && !wasLow:
+		log.Printf("[WARN] Only %d of %d api requests left until %s", remaining, limit, r.reset.Format(time.RFC3339))
+	}
+}
+
+// low is true once under a tenth of the budget is left
+func (r *rateLimit) low() bool {
+	return r.known && r.limit > 0 && r.remaining*10 < r.limit
+}
+
+// budget returns the requests left and when the budget resets, with ok false
+// if netlify hasn't said yet
+func (r *rateLimit) budget() (remaining int64, reset time.Time, ok bool) {
+	if r == nil {
+		return 0, time.Time{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining, r.reset, r.known
+}
+
+// warnIfExhausting warns when uploading files would take more requests than
+// are left, every upload being at least one request
+func (r *rateLimit) warnIfExhausting(files int) {
+	remaining, reset, ok := r.budget()
+	if !ok || int64(files) <= remaining {
+		return
+	}
+
+	log.Printf("[WARN] Uploading %d files needs at least %d api requests but only %d are left until %s, uploads will be throttled",
+		files, files, remaining, reset.Format(time.RFC3339))
+}
+
+// rateLimitTransport records the rate limit of every api response
+type rateLimitTransport struct {
+	next      http.RoundTripper
+	rateLimit *rateLimit
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && req.URL.Host == netlifyAPIHost {
+		t.rateLimit.record(resp)
+	}
+	return resp, err
+}
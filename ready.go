@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	netlify "github.com/netlify/open-api/go/models"
+)
+
+// readyVerifyPath is the file fetched from the CDN to check the new deploy is
+// being served, index.html is the one file nearly every site has
+const readyVerifyPath = "/index.html"
+
+// readyFetchTimeout caps each fetch from the CDN when --api-timeout is unset
+const readyFetchTimeout = 10 * time.Second
+
+// waitForRollout gives the CDN time to catch up after netlify reports the
+// deploy as ready. With verify set it re-fetches index.html until the site's
+// url serves the same content as the deploy's own permalink, for at most the
+// grace period. The file on disk can't be compared, netlify rewrites html as
+// it processes a deploy (pretty urls, snippet injection), but the permalink
+// only ever serves this deploy so it has the processed content to expect.
+func (cfg *config) waitForRollout(deploy *netlify.Deploy, filenameToSha map[string]string) {
+	if cfg.ReadyGrace <= 0 {
+		return
+	}
+
+	if _, ok := filenameToSha[readyVerifyPath]; !cfg.ReadyVerify || !ok {
+		log.Printf("Waiting %s for the deploy to propagate", cfg.ReadyGrace)
+		cfg.clock.Sleep(cfg.ReadyGrace)
+		return
+	}
+
+	permalink := strings.TrimSuffix(deploy.DeploySslURL, "/") + readyVerifyPath
+	url := strings.TrimSuffix(deploy.SslURL, "/") + readyVerifyPath
+	if deploy.Draft || deploy.Branch != "" || url == permalink {
+		// drafts and branch deploys are only served at their own url, which
+		// has nothing older to compare with
+		log.Printf("[WARN] rollout verification skipped, %s is only served at its own url %s", deploy.ID, deploy.DeploySslURL)
+		return
+	}
+
+	expected := ""
+	deadline := cfg.clock.Now().Add(cfg.ReadyGrace)
+	for cfg.ctx.Err() == nil {
+		if expected == "" {
+			expected, _ = cfg.fetchSha1(permalink)
+		}
+
+		if expected != "" {
+			actual, err := cfg.fetchSha1(url)
+			if err == nil && actual == expected {
+				log.Printf("CDN is serving the new deploy at %s", url)
+				return
+			}
+		}
+
+		if cfg.clock.Now().After(deadline) {
+			log.Printf("[WARN] CDN still isn't serving the new %s after %s", url, cfg.ReadyGrace)
+			return
+		}
+
+		cfg.clock.Sleep(time.Second)
+	}
+}
+
+// fetchSha1 hashes what url serves, through the same client as api calls so
+// proxies and tls settings apply
+func (cfg *config) fetchSha1(url string) (string, error) {
+	timeout := cfg.APITimeout
+	if timeout <= 0 {
+		timeout = readyFetchTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(cfg.ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, resp.Body); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	netlify "github.com/netlify/open-api/go/models"
+)
+
+// testReadyConfig is a config whose CDN serves the permalink's content at
+// the site's url once it has been asked stale more times
+func testReadyConfig(t *testing.T, stale int) (*config, *bytes.Buffer) {
+	t.Helper()
+
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Host == "site.netlify.app" && stale > 0 {
+			stale--
+			w.Write([]byte("old"))
+			return
+		}
+		w.Write([]byte("new"))
+	}))
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	return &config{
+		ReadyGrace:  10 * time.Second,
+		ReadyVerify: true,
+		httpClient:  &http.Client{Transport: redirectTransport{target}},
+		clock:       newFakeClock(),
+		ctx:         context.Background(),
+	}, &logs
+}
+
+func TestWaitForRollout(t *testing.T) {
+	deploy := &netlify.Deploy{ID: "deploy", SslURL: "https://site.netlify.app", DeploySslURL: "https://deploy--site.netlify.app"}
+	files := map[string]string{"/index.html": "sha"}
+
+	tests := []struct {
+		name   string
+		deploy netlify.Deploy
+		stale  int
+		want   string
+	}{
+		{
+			name:   "served at once",
+			deploy: *deploy,
+			want:   "CDN is serving the new deploy",
+		},
+		{
+			name:   "served after a while",
+			deploy: *deploy,
+			stale:  3,
+			want:   "CDN is serving the new deploy",
+		},
+		{
+			name:   "never served",
+			deploy: *deploy,
+			stale:  1000,
+			want:   "[WARN] CDN still isn't serving",
+		},
+		{
+			name:   "draft",
+			deploy: netlify.Deploy{ID: "deploy", Draft: true, SslURL: deploy.SslURL, DeploySslURL: deploy.DeploySslURL},
+			want:   "[WARN] rollout verification skipped",
+		},
+		{
+			name:   "branch deploy",
+			deploy: netlify.Deploy{ID: "deploy", Branch: "staging", SslURL: deploy.SslURL, DeploySslURL: deploy.DeploySslURL},
+			want:   "[WARN] rollout verification skipped",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, logs := testReadyConfig(t, tt.stale)
+
+			cfg.waitForRollout(&tt.deploy, files)
+			if !strings.Contains(logs.String(), tt.want) {
+				t.Errorf("logged %q, want %q", logs.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// validRedirectStatuses are the status codes netlify accepts in _redirects
+var validRedirectStatuses = map[int]bool{
+	200: true,
+	301: true,
+	302: true,
+	303: true,
+	307: true,
+	308: true,
+	404: true,
+	410: true,
+	451: true,
+}
+
+type redirectRule struct {
+	line       int
+	from       string
+	query      map[string]string
+	to         string
+	status     int
+	force      bool
+	conditions map[string]string
+}
+
+type headerRule struct {
+	line    int
+	path    string
+	headers [][2]string
+}
+
+type ruleProblem struct {
+	file    string
+	line    int
+	message string
+}
+
+func (p ruleProblem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.file, p.line, p.message)
+}
+
+// parseRedirects reads the _redirects format: from [query=value...] to
+// [status[!]] [Condition=value...], one rule per line, # for comments.
+func parseRedirects(r io.Reader) ([]*redirectRule, []ruleProblem) {
+	rules := []*redirectRule{}
+	problems := []ruleProblem{}
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		problem := func(format string, args ...interface{}) {
+			problems = append(problems, ruleProblem{"_redirects", lineNo, fmt.Sprintf(format, args...)})
+		}
+
+		fields := strings.Fields(line)
+		rule := &redirectRule{
+			line:       lineNo,
+			from:       fields[0],
+			query:      map[string]string{},
+			status:     301,
+			conditions: map[string]string{},
+		}
+
+		if !isRulePath(rule.from) {
+			problem("%q is not a path or url", rule.from)
+			continue
+		}
+
+		rest := fields[1:]
+		for len(rest) > 0 && strings.Contains(rest[0], "=") && !isRulePath(rest[0]) {
+			kv := strings.SplitN(rest[0], "=", 2)
+			rule.query[kv[0]] = kv[1]
+			rest = rest[1:]
+		}
+
+		if len(rest) == 0 {
+			problem("missing destination for %s", rule.from)
+			continue
+		}
+
+		rule.to = rest[0]
+		rest = rest[1:]
+		if !isRulePath(rule.to) {
+			problem("destination %q is not a path or url", rule.to)
+			continue
+		}
+
+		if len(rest) > 0 && !strings.Contains(rest[0], "=") {
+			status := rest[0]
+			rest = rest[1:]
+
+			if strings.HasSuffix(status, "!") {
+				rule.force = true
+				status = strings.TrimSuffix(status, "!")
+			}
+
+			code, err := strconv.Atoi(status)
+			if err != nil {
+				problem("%q is not a status code", status)
+				continue
+			}
+
+			if !validRedirectStatuses[code] {
+				problem("status %d is not supported", code)
+				continue
+			}
+			rule.status = code
+		}
+
+		for _, condition := range rest {
+			kv := strings.SplitN(condition, "=", 2)
+			if len(kv) != 2 {
+				problem("unexpected %q after the status", condition)
+				continue
+			}
+			rule.conditions[kv[0]] = kv[1]
+		}
+
+		for _, placeholder := range rulePlaceholders(rule.to) {
+			if !ruleDefines(rule, placeholder) {
+				problem("destination uses :%s which %s doesn't define", placeholder, rule.from)
+			}
+		}
+
+		rules = append(rules, rule)
+	}
+
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, ruleProblem{"_redirects", lineNo, err.Error()})
+	}
+
+	return rules, problems
+}
+
+// parseHeaders reads the _headers format: a path on its own line followed by
+// indented "Name: value" lines.
+func parseHeaders(r io.Reader) ([]*headerRule, []ruleProblem) {
+	rules := []*headerRule{}
+	problems := []ruleProblem{}
+
+	var current *headerRule
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		line := strings.TrimSpace(raw)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		indented := raw[0] == ' ' || raw[0] == '\t'
+		if !indented {
+			if !isRulePath(line) {
+				problems = append(problems, ruleProblem{"_headers", lineNo, fmt.Sprintf("%q is not a path or url", line)})
+				current = nil
+				continue
+			}
+
+			current = &headerRule{line: lineNo, path: line}
+			rules = append(rules, current)
+			continue
+		}
+
+		if current == nil {
+			problems = append(problems, ruleProblem{"_headers", lineNo, "header without a path above it"})
+			continue
+		}
+
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			problems = append(problems, ruleProblem{"_headers", lineNo, fmt.Sprintf("%q is not a Name: value header", line)})
+			continue
+		}
+
+		current.headers = append(current.headers, [2]string{strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])})
+	}
+
+	if err := scanner.Err(); err != nil {
+		problems = append(problems, ruleProblem{"_headers", lineNo, err.Error()})
+	}
+
+	for _, rule := range rules {
+		if len(rule.headers) == 0 {
+			problems = append(problems, ruleProblem{"_headers", rule.line, fmt.Sprintf("%s has no headers", rule.path)})
+		}
+	}
+
+	return rules, problems
+}
+
+func isRulePath(s string) bool {
+	return strings.HasPrefix(s, "/") || strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// rulePlaceholders lists the :name segments used in a redirect destination
+func rulePlaceholders(to string) []string {
+	placeholders := []string{}
+	for _, segment := range strings.FieldsFunc(to, func(r rune) bool { return r == '/' || r == '?' || r == '&' || r == '=' }) {
+		if strings.HasPrefix(segment, ":") && len(segment) > 1 {
+			placeholders = append(placeholders, segment[1:])
+		}
+	}
+
+	return placeholders
+}
+
+func ruleDefines(rule *redirectRule, placeholder string) bool {
+	if placeholder == "splat" {
+		return strings.HasSuffix(rule.from, "*")
+	}
+
+	for _, segment := range strings.Split(rule.from, "/") {
+		if segment == ":"+placeholder {
+			return true
+		}
+	}
+
+	for _, value := range rule.query {
+		if value == ":"+placeholder {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shadowedRedirects finds rules that can never match, either because an
+// earlier unconditional rule already catches the same path or because a file
+// exists at the path and the rule isn't forced.
+func shadowedRedirects(rules []*redirectRule, files map[string]string) []ruleProblem {
+	problems := []ruleProblem{}
+
+	for i, rule := range rules {
+		for _, earlier := range rules[:i] {
+			if len(earlier.conditions) > 0 || len(earlier.query) > 0 {
+				continue
+			}
+
+			prefix := strings.TrimSuffix(earlier.from, "*")
+			if earlier.from == rule.from || (strings.HasSuffix(earlier.from, "*") && strings.HasPrefix(rule.from, prefix)) {
+				problems = append(problems, ruleProblem{"_redirects", rule.line, fmt.Sprintf("%s is unreachable, line %d already matches it", rule.from, earlier.line)})
+				break
+			}
+		}
+
+		if _, ok := files[rule.from]; ok && !rule.force && rule.status != 404 {
+			problems = append(problems, ruleProblem{"_redirects", rule.line, fmt.Sprintf("%s is a file so this rule never applies, use %d! to force it", rule.from, rule.status)})
+		}
+	}
+
+	return problems
+}
+
+// validateRules checks _redirects and _headers in dir, logging every problem.
+// It returns an error when strict is set and anything was found.
+func validateRules(dir string, files map[string]string, strict bool) error {
+	problems := []ruleProblem{}
+
+	if f, err := os.Open(filepath.Join(dir, "_redirects")); err == nil {
+		rules, parseProblems := parseRedirects(f)
+		f.Close()
+		problems = append(problems, parseProblems...)
+		problems = append(problems, shadowedRedirects(rules, files)...)
+	}
+
+	if f, err := os.Open(filepath.Join(dir, "_headers")); err == nil {
+		_, parseProblems := parseHeaders(f)
+		f.Close()
+		problems = append(problems, parseProblems...)
+	}
+
+	for _, problem := range problems {
+		log.Printf("[WARN] %s", problem)
+	}
+
+	if strict && len(problems) > 0 {
+		return fmt.Errorf("Found %d problems in _redirects and _headers", len(problems))
+	}
+
+	return nil
+}
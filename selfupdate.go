@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var selfUpdateCommand = &cli.Command{
+	Name:   "self-update",
+	Usage:  "replace this binary with the latest release from github, only checked against the release's checksums.txt as releases aren't signed",
+	Action: selfUpdate,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "check",
+			Usage: "Only report whether a newer release exists",
+		},
+	},
+}
+
+// latestReleaseURL is the github api for this project's newest release
+const latestReleaseURL = "https://api.github.com/repos/halkeye/" + projectName + "/releases/latest"
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r *githubRelease) assetURL(name string) (string, error) {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL, nil
+		}
+	}
+
+	return "", fmt.Errorf("release %s has no %s", r.TagName, name)
+}
+
+// newerVersion reports if release is newer than current, comparing the
+// numeric parts of two x.y.z versions
+func newerVersion(release string, current string) bool {
+	releaseParts := strings.Split(strings.TrimPrefix(release, "v"), ".")
+	currentParts := strings.Split(strings.TrimPrefix(current, "v"), ".")
+
+	for i := 0; i < len(releaseParts) || i < len(currentParts); i++ {
+		var r, c int
+		if i < len(releaseParts) {
+			r, _ = strconv.Atoi(releaseParts[i])
+		}
+		if i < len(currentParts) {
+			c, _ = strconv.Atoi(currentParts[i])
+		}
+
+		if r != c {
+			return r > c
+		}
+	}
+
+	return false
+}
+
+// download fetches url into w through the same client as api calls, so
+// proxies and tls settings apply. A release archive can take as long as it
+// needs, the download is only given up when nothing arrives for --api-timeout.
+func (cfg *config) download(url string, w io.Writer) error {
+	ctx, cancel := context.WithCancel(cfg.ctx)
+	defer cancel()
+
+	var stalled *time.Timer
+	if cfg.APITimeout > 0 {
+		stalled = time.AfterFunc(cfg.APITimeout, cancel)
+		defer stalled.Stop()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return cfg.downloadError(url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	var body io.Reader = resp.Body
+	if stalled != nil {
+		body = &stallReader{Reader: resp.Body, timer: stalled, timeout: cfg.APITimeout}
+	}
+
+	if _, err := io.Copy(w, body); err != nil {
+		return cfg.downloadError(url, err)
+	}
+
+	return nil
+}
+
+// downloadError says when a download was given up for stalling, rather than
+// a bare context canceled
+func (cfg *config) downloadError(url string, err error) error {
+	if cfg.ctx.Err() == nil && stderrors.Is(err, context.Canceled) {
+		return fmt.Errorf("%s sent nothing for %s", url, cfg.APITimeout)
+	}
+
+	return err
+}
+
+// stallReader pushes timer back by timeout whenever data arrives
+type stallReader struct {
+	io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+
+	return n, err
+}
+
+// releaseChecksum finds the sha256 of name in a goreleaser checksums.txt
+func releaseChecksum(checksums io.Reader, name string) (string, error) {
+	scanner := bufio.NewScanner(checksums)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[1] == name {
+			return fields[0], nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("checksums.txt has no entry for %s", name)
+}
+
+// selfUpdate downloads the release archive for this platform, checks it
+// against the release's checksums.txt and swaps it in for the running binary.
+// Releases aren't signed, so the checksum is all there is to verify.
+func selfUpdate(c *cli.Context) error {
+	if version == "dev" {
+		return fmt.Errorf("This is a development build, update it from source instead")
+	}
+
+	cfg, err := newAnonymousConfig(c)
+	if err != nil {
+		return err
+	}
+
+	var body strings.Builder
+	if err := cfg.download(latestReleaseURL, &body); err != nil {
+		return errors.Wrap(err, "Unable to find the latest release")
+	}
+
+	release := githubRelease{}
+	if err := json.Unmarshal([]byte(body.String()), &release); err != nil {
+		return errors.Wrap(err, "Unable to parse the latest release")
+	}
+
+	if !newerVersion(release.TagName, version) {
+		log.Printf("%s is the latest release", version)
+		return nil
+	}
+
+	log.Printf("%s is available, this is %s", release.TagName, version)
+	if c.Bool("check") {
+		return nil
+	}
+
+	releaseVersion := strings.TrimPrefix(release.TagName, "v")
+	artifact := releaseArtifactName(releaseVersion, runtime.GOOS, runtime.GOARCH)
+
+	checksumsURL, err := release.assetURL("checksums.txt")
+	if err != nil {
+		return err
+	}
+	artifactURL, err := release.assetURL(artifact)
+	if err != nil {
+		return err
+	}
+
+	var checksums strings.Builder
+	if err := cfg.download(checksumsURL, &checksums); err != nil {
+		return errors.Wrap(err, "Unable to download checksums.txt")
+	}
+	expected, err := releaseChecksum(strings.NewReader(checksums.String()), artifact)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "netlify-deploy-update-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	archive, err := os.Create(filepath.Join(dir, artifact))
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	err = cfg.download(artifactURL, io.MultiWriter(archive, hash))
+	archive.Close()
+	if err != nil {
+		return errors.Wrapf(err, "Unable to download %s", artifact)
+	}
+
+	if actual := fmt.Sprintf("%x", hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("%s has sha256 %s but checksums.txt says %s", artifact, actual, expected)
+	}
+
+	extracted := filepath.Join(dir, "extracted")
+	if strings.HasSuffix(artifact, ".zip") {
+		err = extractZip(archive.Name(), extracted)
+	} else {
+		var f *os.File
+		if f, err = os.Open(archive.Name()); err == nil {
+			err = extractTar(f, extracted)
+			f.Close()
+		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Unable to extract %s", artifact)
+	}
+
+	binary := projectName
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	if err := replaceExecutable(filepath.Join(extracted, binary)); err != nil {
+		return err
+	}
+
+	log.Printf("Updated to %s", release.TagName)
+
+	return nil
+}
+
+// replaceExecutable moves the running binary aside and puts replacement in
+// its place. Windows can't overwrite a running binary but can rename it, so
+// the old one is left behind there until the next update.
+func replaceExecutable(replacement string) error {
+	current, err := os.Executable()
+	if err != nil {
+		return errors.Wrap(err, "Unable to find the running binary")
+	}
+	if current, err = filepath.EvalSymlinks(current); err != nil {
+		return errors.Wrap(err, "Unable to find the running binary")
+	}
+
+	// stage next to the binary so the final rename doesn't cross filesystems
+	staged := current + ".new"
+	if err := copyFile(replacement, staged); err != nil {
+		return errors.Wrapf(err, "Unable to write %s", staged)
+	}
+	if err := os.Chmod(staged, 0755); err != nil {
+		return err
+	}
+
+	old := current + ".old"
+	os.Remove(old)
+	if err := os.Rename(current, old); err != nil {
+		os.Remove(staged)
+		return errors.Wrapf(err, "Unable to move %s aside", current)
+	}
+
+	if err := os.Rename(staged, current); err != nil {
+		os.Rename(old, current)
+		return errors.Wrapf(err, "Unable to replace %s", current)
+	}
+
+	os.Remove(old)
+
+	return nil
+}
+
+func copyFile(from string, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
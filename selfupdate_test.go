@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDownload(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("part of it"))
+		if r.URL.Path == "/stalls" {
+			w.(http.Flusher).Flush()
+			<-release
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config{
+		APITimeout: 100 * time.Millisecond,
+		httpClient: &http.Client{Transport: redirectTransport{target}},
+		ctx:        context.Background(),
+	}
+
+	var body strings.Builder
+	if err := cfg.download("https://github.com/releases/checksums.txt", &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.String() != "part of it" {
+		t.Errorf("downloaded %q", body.String())
+	}
+
+	err = cfg.download("https://github.com/stalls", &strings.Builder{})
+	if err == nil || !strings.Contains(err.Error(), "sent nothing for 100ms") {
+		t.Errorf("got %v, want the stalled download given up", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sensitiveFilePatterns are base names that almost never belong on a public site
+var sensitiveFilePatterns = []string{
+	".env",
+	".env.*",
+	"*.env",
+	"id_rsa",
+	"id_dsa",
+	"id_ecdsa",
+	"id_ed25519",
+	"*.pem",
+	"*.key",
+	"*.p12",
+	"*.pfx",
+	"*.kdbx",
+	".npmrc",
+	".pypirc",
+	".netrc",
+	".htpasswd",
+	"credentials",
+	"credentials.json",
+	"service-account*.json",
+}
+
+// maxCredentialScanSize keeps the content check to files small enough to be
+// a credential file rather than a data dump
+const maxCredentialScanSize = 64 * 1024
+
+// looksLikeCloudCredentials spots google service account keys and similar
+// json credential files regardless of what they were renamed to
+func looksLikeCloudCredentials(filename string) bool {
+	if !strings.HasSuffix(filename, ".json") {
+		return false
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	contents, err := io.ReadAll(io.LimitReader(f, maxCredentialScanSize+1))
+	if err != nil || len(contents) > maxCredentialScanSize {
+		return false
+	}
+
+	return bytes.Contains(contents, []byte(`"private_key"`)) ||
+		bytes.Contains(contents, []byte(`"aws_secret_access_key"`)) ||
+		bytes.Contains(contents, []byte(`"client_secret"`))
+}
+
+// findSensitiveFiles returns the uris of files that look like secrets
+func findSensitiveFiles(dir string, filenameToSha map[string]string) []string {
+	found := []string{}
+
+	for uri := range filenameToSha {
+		base := path.Base(filepath.ToSlash(uri))
+
+		sensitive := false
+		for _, pattern := range sensitiveFilePatterns {
+			if ok, _ := path.Match(pattern, base); ok {
+				sensitive = true
+				break
+			}
+		}
+
+		if sensitive || looksLikeCloudCredentials(filepath.Join(dir, uri)) {
+			found = append(found, uri)
+		}
+	}
+
+	sort.Strings(found)
+	return found
+}
+
+// checkSensitiveFiles refuses to deploy secret looking files unless allowed
+func checkSensitiveFiles(dir string, filenameToSha map[string]string, allow bool) error {
+	found := findSensitiveFiles(dir, filenameToSha)
+	if len(found) == 0 {
+		return nil
+	}
+
+	for _, uri := range found {
+		log.Printf("[WARN] %s looks like it contains secrets", uri)
+	}
+
+	if allow {
+		return nil
+	}
+
+	return fmt.Errorf("Refusing to deploy %d sensitive looking files, pass --allow-sensitive-files if they are meant to be public", len(found))
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+var serveCommand = &cli.Command{
+	Name:   "serve",
+	Usage:  "serve deployDir locally with netlify's _redirects and _headers rules applied",
+	Action: serve,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "Address to serve on",
+			Value: "127.0.0.1:8888",
+		},
+	},
+}
+
+// previewServer mimics how netlify serves a deploy closely enough to try out
+// rules before deploying. Rules are re-read on every request so edits to
+// _redirects and _headers show up without a restart. Rules with conditions
+// (country, language, role, cookie) never match as there is nothing local to
+// check them against.
+type previewServer struct {
+	dir string
+}
+
+func serve(c *cli.Context) error {
+	dir := "."
+	if sources := parseSourceDirs(c.StringSlice("deployDir")); len(sources) > 0 {
+		dir = sources[0].dir
+	}
+
+	server := &http.Server{Addr: c.String("listen"), Handler: &previewServer{dir: dir}}
+	go func() {
+		<-c.Context.Done()
+		server.Close()
+	}()
+
+	log.Printf("Serving %s on http://%s", dir, c.String("listen"))
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return nil
+}
+
+// findFile resolves a request path the way netlify's pretty urls do, /about
+// can be about, about.html or about/index.html
+func (s *previewServer) findFile(urlPath string) (string, bool) {
+	clean := path.Clean("/" + urlPath)
+	if unservedFiles[clean] {
+		return "", false
+	}
+
+	candidates := []string{clean, clean + ".html", path.Join(clean, "index.html")}
+	if strings.HasSuffix(urlPath, "/") {
+		candidates = []string{path.Join(clean, "index.html")}
+	}
+
+	for _, candidate := range candidates {
+		filename := filepath.Join(s.dir, filepath.FromSlash(candidate))
+		if info, err := os.Stat(filename); err == nil && !info.IsDir() {
+			return filename, true
+		}
+	}
+
+	return "", false
+}
+
+func (s *previewServer) rules() ([]*redirectRule, []*headerRule) {
+	redirects := []*redirectRule{}
+	headers := []*headerRule{}
+
+	if f, err := os.Open(filepath.Join(s.dir, "_redirects")); err == nil {
+		redirects, _ = parseRedirects(f)
+		f.Close()
+	}
+
+	if f, err := os.Open(filepath.Join(s.dir, "_headers")); err == nil {
+		headers, _ = parseHeaders(f)
+		f.Close()
+	}
+
+	return redirects, headers
+}
+
+// matchRulePath matches a path against a rule's from, which can have :name
+// segments and end in a * splat, returning what they captured
+func matchRulePath(pattern string, urlPath string) (map[string]string, bool) {
+	params := map[string]string{}
+
+	trim := func(p string) string {
+		if p != "/" {
+			return strings.TrimSuffix(p, "/")
+		}
+		return p
+	}
+
+	patternSegments := strings.Split(trim(pattern), "/")
+	pathSegments := strings.Split(trim(urlPath), "/")
+
+	for i, segment := range patternSegments {
+		if segment == "*" && i == len(patternSegments)-1 {
+			if i <= len(pathSegments) {
+				params["splat"] = strings.Join(pathSegments[i:], "/")
+				return params, true
+			}
+			return nil, false
+		}
+
+		if i >= len(pathSegments) {
+			return nil, false
+		}
+
+		if strings.HasPrefix(segment, ":") && len(segment) > 1 {
+			params[segment[1:]] = pathSegments[i]
+			continue
+		}
+
+		if segment != pathSegments[i] {
+			return nil, false
+		}
+	}
+
+	if len(patternSegments) != len(pathSegments) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+var rulePlaceholder = regexp.MustCompile(`:([A-Za-z_][A-Za-z0-9_]*)`)
+
+// expandRuleDestination fills a rule's to with what its from captured
+func expandRuleDestination(to string, params map[string]string) string {
+	return rulePlaceholder.ReplaceAllStringFunc(to, func(placeholder string) string {
+		if value, ok := params[placeholder[1:]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// matchRuleQuery checks the query parameters a rule requires, capturing the
+// ones given as :name
+func matchRuleQuery(rule *redirectRule, query url.Values, params map[string]string) bool {
+	for key, value := range rule.query {
+		got := query.Get(key)
+		if got == "" {
+			return false
+		}
+
+		if strings.HasPrefix(value, ":") {
+			params[value[1:]] = got
+		} else if got != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func applyHeaderRules(w http.ResponseWriter, rules []*headerRule, urlPath string) {
+	for _, rule := range rules {
+		if _, ok := matchRulePath(rule.path, urlPath); !ok {
+			continue
+		}
+
+		for _, header := range rule.headers {
+			w.Header().Add(header[0], header[1])
+		}
+	}
+}
+
+func writeFile(w http.ResponseWriter, r *http.Request, filename string, status int) {
+	if status == http.StatusOK {
+		http.ServeFile(w, r, filename)
+		return
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(filename)))
+	w.WriteHeader(status)
+	io.Copy(w, f)
+}
+
+func (s *previewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	redirects, headers := s.rules()
+	filename, exists := s.findFile(r.URL.Path)
+
+	for _, rule := range redirects {
+		if len(rule.conditions) > 0 || !strings.HasPrefix(rule.from, "/") {
+			continue
+		}
+
+		params, ok := matchRulePath(rule.from, r.URL.Path)
+		if !ok || !matchRuleQuery(rule, r.URL.Query(), params) {
+			continue
+		}
+
+		if exists && !rule.force {
+			// a file at the path wins over a rule that isn't forced
+			break
+		}
+
+		to := expandRuleDestination(rule.to, params)
+		applyHeaderRules(w, headers, r.URL.Path)
+		log.Printf("%s %s -> %s %d (_redirects line %d)", r.Method, r.URL.Path, to, rule.status, rule.line)
+
+		switch {
+		case rule.status >= 300 && rule.status < 400:
+			http.Redirect(w, r, to, rule.status)
+		case isRulePath(to) && !strings.HasPrefix(to, "/"):
+			s.proxy(w, r, to)
+		default:
+			target, ok := s.findFile(to)
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeFile(w, r, target, rule.status)
+		}
+		return
+	}
+
+	if exists {
+		applyHeaderRules(w, headers, r.URL.Path)
+		writeFile(w, r, filename, http.StatusOK)
+		return
+	}
+
+	if notFound, ok := s.findFile("/404.html"); ok {
+		applyHeaderRules(w, headers, r.URL.Path)
+		writeFile(w, r, notFound, http.StatusNotFound)
+		return
+	}
+
+	http.NotFound(w, r)
+}
+
+// proxy handles 200 rules to another host, netlify passes the query along
+func (s *previewServer) proxy(w http.ResponseWriter, r *http.Request, to string) {
+	target, err := url.Parse(to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			query := req.URL.RawQuery
+			req.URL = target
+			req.Host = target.Host
+			if query != "" && target.RawQuery == "" {
+				req.URL.RawQuery = query
+			}
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
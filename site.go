@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var siteCommand = &cli.Command{
+	Name:    "site",
+	Aliases: []string{"sites"},
+	Usage:   "manage the site itself",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "list the sites the token can see, or those of --account",
+			Action: listSites,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "name",
+					Usage: "Only list sites whose name contains this",
+				},
+				&cli.StringFlag{
+					Name:  "filter",
+					Usage: "all, owner or guest, ignored with --account",
+					Value: "all",
+				},
+				&cli.StringFlag{
+					Name:  "format",
+					Usage: "Output format, table or json",
+					Value: "table",
+				},
+			},
+		},
+		{
+			Name:   "create",
+			Usage:  "create a new site, in --account's team if given",
+			Action: createSite,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "name",
+					Usage:    "Name of the site, which is also its netlify.app subdomain",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "custom-domain",
+					Usage: "Primary custom domain of the site",
+				},
+				&cli.StringFlag{
+					Name:  "account",
+					Usage: "Team (account slug) to create the site in",
+				},
+			},
+		},
+		{
+			Name:      "delete",
+			Usage:     "delete a site and all of its deploys",
+			ArgsUsage: "<name-or-id>",
+			Action:    deleteSite,
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "yes",
+					Usage: "Don't ask for confirmation, needed when not running in a terminal",
+				},
+			},
+		},
+		{
+			Name:   "update",
+			Usage:  "change the settings of the site",
+			Action: updateSite,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "custom-domain",
+					Usage: "Primary custom domain of the site",
+				},
+				&cli.StringSliceFlag{
+					Name:  "domain-alias",
+					Usage: "Additional domain for the site, can be repeated",
+				},
+				&cli.StringFlag{
+					Name:  "password",
+					Usage: "Password protect the site",
+				},
+				&cli.BoolFlag{
+					Name:  "force-ssl",
+					Usage: "Redirect http traffic to https",
+				},
+				&cli.BoolFlag{
+					Name:  "skip-processing",
+					Usage: "Turn off asset optimization",
+				},
+				&cli.BoolFlag{
+					Name:  "optimize-images",
+					Usage: "Turn on image optimization",
+				},
+				&cli.BoolFlag{
+					Name:  "pretty-urls",
+					Usage: "Turn on pretty urls",
+				},
+				&cli.StringFlag{
+					Name:  "build-command",
+					Usage: "Command netlify runs to build the site",
+				},
+				&cli.StringFlag{
+					Name:  "publish-dir",
+					Usage: "Directory netlify publishes after building",
+				},
+			},
+		},
+	},
+}
+
+// createSite makes an empty site to deploy into, like a preview environment
+// for a branch
+func createSite(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	// --account is also a global flag, which this one hides when not given
+	if !c.IsSet("account") {
+		cfg.Account = rootContext(c).String("account")
+	}
+
+	setup := &netlify.SiteSetup{}
+	setup.Name = c.String("name")
+	setup.CustomDomain = c.String("custom-domain")
+
+	var site *netlify.Site
+	if cfg.Account != "" {
+		created, err := cfg.netlifyClient().Operations.CreateSiteInTeam(
+			operations.NewCreateSiteInTeamParams().WithTimeout(cfg.APITimeout).WithAccountSlug(cfg.Account).WithSite(setup),
+			authInfo(cfg.Token),
+		)
+		if err != nil {
+			return errors.Wrap(classifyAPIError(err), "Unable to create site")
+		}
+		site = created.GetPayload()
+	} else {
+		created, err := cfg.netlifyClient().Operations.CreateSite(
+			operations.NewCreateSiteParams().WithTimeout(cfg.APITimeout).WithSite(setup),
+			authInfo(cfg.Token),
+		)
+		if err != nil {
+			return errors.Wrap(classifyAPIError(err), "Unable to create site")
+		}
+		site = created.GetPayload()
+	}
+
+	log.Printf("Created site %s", site.Name)
+
+	fmt.Printf("id:\t%s\n", site.ID)
+	fmt.Printf("name:\t%s\n", site.Name)
+	fmt.Printf("url:\t%s\n", site.SslURL)
+	fmt.Printf("admin url:\t%s\n", site.AdminURL)
+
+	return nil
+}
+
+// lookupSite finds a site by name, or failing that by id
+func (cfg *config) lookupSite(nameOrID string) (*netlify.Site, error) {
+	site, err := cfg.findSite(nameOrID)
+	if err != nil || site != nil {
+		return site, err
+	}
+
+	resp, err := cfg.netlifyClient().Operations.GetSite(
+		operations.NewGetSiteParams().WithTimeout(cfg.APITimeout).WithSiteID(nameOrID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		if apiStatusCode(err) == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: no site found for %s", ErrSiteNotFound, nameOrID)
+		}
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to get site")
+	}
+
+	return resp.GetPayload(), nil
+}
+
+// deleteSite tears down a site, like a preview environment once its branch
+// is merged. Without --yes the site name has to be typed back.
+func deleteSite(c *cli.Context) error {
+	nameOrID := c.Args().First()
+	if nameOrID == "" {
+		return fmt.Errorf("site delete requires a site name or id")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.lookupSite(nameOrID)
+	if err != nil {
+		return err
+	}
+
+	if !c.Bool("yes") {
+		if !isInteractive() {
+			return fmt.Errorf("Refusing to delete %s without --yes when not running in a terminal", site.Name)
+		}
+
+		fmt.Printf("Type %s to delete it and all of its deploys: ", site.Name)
+		answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		if strings.TrimSpace(answer) != site.Name {
+			return fmt.Errorf("Not deleting %s", site.Name)
+		}
+	}
+
+	_, err = cfg.netlifyClient().Operations.DeleteSite(
+		operations.NewDeleteSiteParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to delete site")
+	}
+
+	log.Printf("Deleted site %s (%s)", site.Name, site.ID)
+
+	return nil
+}
+
+// updateSite only sends the settings that were passed on the command line.
+// The generated models omit false values, so settings can be turned on here
+// but have to be turned off in the netlify ui.
+func updateSite(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	setup := &netlify.SiteSetup{}
+
+	if c.IsSet("custom-domain") {
+		setup.CustomDomain = c.String("custom-domain")
+	}
+
+	if c.IsSet("domain-alias") {
+		setup.DomainAliases = c.StringSlice("domain-alias")
+	}
+
+	if c.IsSet("password") {
+		setup.Password = c.String("password")
+	}
+
+	setup.ForceSsl = c.Bool("force-ssl")
+
+	if c.IsSet("skip-processing") || c.IsSet("optimize-images") || c.IsSet("pretty-urls") {
+		setup.ProcessingSettings = &netlify.SiteProcessingSettings{
+			Skip:   c.Bool("skip-processing"),
+			HTML:   &netlify.SiteProcessingSettingsHTML{PrettyUrls: c.Bool("pretty-urls")},
+			Images: &netlify.SiteProcessingSettingsImages{Optimize: c.Bool("optimize-images")},
+		}
+	}
+
+	if c.IsSet("build-command") || c.IsSet("publish-dir") {
+		setup.BuildSettings = &netlify.RepoInfo{
+			Cmd: c.String("build-command"),
+			Dir: c.String("publish-dir"),
+		}
+	}
+
+	updated, err := cfg.netlifyClient().Operations.UpdateSite(
+		operations.NewUpdateSiteParams().WithTimeout(cfg.APITimeout).WithSiteID(site.ID).WithSite(setup),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to update site")
+	}
+
+	log.Printf("Updated site %s", updated.GetPayload().Name)
+
+	if updated.GetPayload().CustomDomain != "" {
+		fmt.Printf("custom domain:\t%s\n", updated.GetPayload().CustomDomain)
+	}
+
+	for _, alias := range updated.GetPayload().DomainAliases {
+		fmt.Printf("domain alias:\t%s\n", alias)
+	}
+
+	return nil
+}
+
+func listSites(c *cli.Context) error {
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		return fmt.Errorf("Unknown format %s, expected table or json", format)
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	sites := []*netlify.Site{}
+	query := siteQuery{Name: c.String("name"), Filter: c.String("filter")}
+	err = cfg.eachSite(query, func(site *netlify.Site) bool {
+		sites = append(sites, site)
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sites)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tURL\tACCOUNT")
+	for _, site := range sites {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", site.ID, site.Name, site.SslURL, site.AccountSlug)
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// sourceDir is one --deployDir, deployed under prefix
+type sourceDir struct {
+	dir    string
+	prefix string
+}
+
+// parseSourceDirs splits every --deployDir given as dir:/prefix. The prefix
+// has to start with a / so windows drive letters aren't mistaken for one.
+func parseSourceDirs(values []string) []sourceDir {
+	sources := []sourceDir{}
+
+	for _, value := range values {
+		source := sourceDir{dir: value}
+		if i := strings.LastIndex(value, ":"); i > 1 && strings.HasPrefix(value[i+1:], "/") {
+			source = sourceDir{dir: value[:i], prefix: normalizePathPrefix(value[i+1:])}
+		}
+		sources = append(sources, source)
+	}
+
+	return sources
+}
+
+// sources is every directory going into the deploy. The first is always
+// cfg.Directory, which prepareSource and the daemon can change.
+func (cfg *config) sources() []sourceDir {
+	if len(cfg.Sources) == 0 {
+		return []sourceDir{{dir: cfg.Directory}}
+	}
+
+	sources := append([]sourceDir{}, cfg.Sources...)
+	sources[0].dir = cfg.Directory
+	return sources
+}
+
+// errFoundFile stops the walk in hasRegularFile at the first file
+var errFoundFile = errors.New("found a file")
+
+// hasRegularFile reports if there is at least one file anywhere under dir
+func hasRegularFile(dir string) (bool, error) {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			return errFoundFile
+		}
+		return nil
+	})
+	if err == errFoundFile {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// validateSources fails fast on a deployDir that doesn't exist, isn't a
+// directory or has no files, before anything is created on netlify. A deploy
+// with no files replaces the whole site with nothing.
+func (cfg *config) validateSources() error {
+	for _, source := range cfg.sources() {
+		info, err := os.Stat(source.dir)
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s doesn't exist, has the site been built?", source.dir)
+		}
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", source.dir)
+		}
+
+		hasFile, err := hasRegularFile(source.dir)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to walk %s", source.dir)
+		}
+		if !hasFile {
+			return fmt.Errorf("%s has no files in it, has the site been built?", source.dir)
+		}
+	}
+
+	return nil
+}
+
+// collectFiles hashes and checks every source directory and merges them into
+// one deploy. The same path coming from two directories is only allowed when
+// the content is the same too.
+func (cfg *config) collectFiles() (map[string]string, map[string][]*shaData, error) {
+	filenameToSha := map[string]string{}
+	shaToFilename := map[string][]*shaData{}
+	from := map[string]string{}
+
+	for _, source := range cfg.sources() {
+		sourceFilenameToSha, sourceShaToFilename, err := filesInDirectory(source.dir, cfg.Walkers, cfg.cache)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "Unable to walk %s", source.dir)
+		}
+
+		checkOversizedFiles(source.dir, sourceFilenameToSha, sourceShaToFilename, cfg.MaxFileSize, cfg.SkipOversized)
+
+		if err := checkSensitiveFiles(source.dir, sourceFilenameToSha, cfg.AllowSensitiveFiles); err != nil {
+			return nil, nil, err
+		}
+
+		if err := substituteEnvFiles(source.dir, cfg.SubstituteEnv, sourceFilenameToSha, sourceShaToFilename); err != nil {
+			return nil, nil, errors.Wrap(err, "Unable to substitute environment variables")
+		}
+
+		if source.prefix != "" {
+			addPathPrefix(source.prefix, sourceFilenameToSha, sourceShaToFilename)
+		}
+
+		for uri, sha := range sourceFilenameToSha {
+			if existing, ok := filenameToSha[uri]; ok && existing != sha {
+				return nil, nil, fmt.Errorf("%s is in both %s and %s with different content", uri, from[uri], source.dir)
+			}
+			if _, ok := from[uri]; !ok {
+				filenameToSha[uri] = sha
+				from[uri] = source.dir
+			}
+		}
+
+		for sha, files := range sourceShaToFilename {
+			for _, data := range files {
+				// identical files from an earlier directory are already queued
+				if from[data.uri] == source.dir {
+					shaToFilename[sha] = append(shaToFilename[sha], data)
+				}
+			}
+		}
+	}
+
+	if cfg.OverlayDir != "" {
+		if err := cfg.applyOverlay(filenameToSha, shaToFilename); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return filenameToSha, shaToFilename, nil
+}
+
+// applyOverlay puts the files of --overlay-dir over the deploy, replacing any
+// file at the same path, so per environment files don't need copying in first
+func (cfg *config) applyOverlay(filenameToSha map[string]string, shaToFilename map[string][]*shaData) error {
+	overlayFilenameToSha, overlayShaToFilename, err := filesInDirectory(cfg.OverlayDir, cfg.Walkers, cfg.cache)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to walk %s", cfg.OverlayDir)
+	}
+
+	if err := checkSensitiveFiles(cfg.OverlayDir, overlayFilenameToSha, cfg.AllowSensitiveFiles); err != nil {
+		return err
+	}
+
+	if err := substituteEnvFiles(cfg.OverlayDir, cfg.SubstituteEnv, overlayFilenameToSha, overlayShaToFilename); err != nil {
+		return errors.Wrap(err, "Unable to substitute environment variables")
+	}
+
+	for uri, sha := range overlayFilenameToSha {
+		if oldSha, ok := filenameToSha[uri]; ok {
+			log.Printf("Using %s from %s", uri, cfg.OverlayDir)
+			removeShaFile(shaToFilename, oldSha, uri)
+		}
+		filenameToSha[uri] = sha
+	}
+
+	for sha, files := range overlayShaToFilename {
+		shaToFilename[sha] = append(shaToFilename[sha], files...)
+	}
+
+	return nil
+}
+
+// stdinDirectory as --deployDir reads a tar archive from stdin
+const stdinDirectory = "-"
+
+// prepareSource turns a deployDir that isn't a plain directory into one,
+// returning a cleanup to remove anything it had to create
+func (cfg *config) prepareSource() (func(), error) {
+	isZip := strings.EqualFold(filepath.Ext(cfg.Directory), ".zip")
+	if info, err := os.Stat(cfg.Directory); err != nil || info.IsDir() {
+		isZip = false
+	}
+
+	if cfg.Directory != stdinDirectory && !isZip {
+		return func() {}, nil
+	}
+
+	dir, err := os.MkdirTemp("", "netlify-deploy-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	if isZip {
+		log.Printf("Reading the deploy from %s", cfg.Directory)
+		err = errors.Wrapf(extractZip(cfg.Directory, dir), "Unable to extract %s", cfg.Directory)
+	} else {
+		log.Print("Reading the deploy from a tar archive on stdin")
+		err = errors.Wrap(extractTar(os.Stdin, dir), "Unable to extract the tar archive from stdin")
+	}
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	cfg.Directory = dir
+	return cleanup, nil
+}
+
+// archivePath is where an archive entry goes under dir, refusing entries that
+// would land outside it
+func archivePath(dir string, name string) (string, error) {
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if target != dir && !strings.HasPrefix(target, dir+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%s points outside the archive", name)
+	}
+
+	return target, nil
+}
+
+func writeArchiveFile(target string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// extractZip unpacks the files of a zip archive into dir
+func extractZip(filename string, dir string) error {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		target, err := archivePath(dir, file.Name)
+		if err != nil {
+			return err
+		}
+
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !file.Mode().IsRegular() {
+			log.Printf("[DEBUG] Skipping %s, only files and directories are deployed", file.Name)
+			continue
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = writeArchiveFile(target, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTar unpacks a tar, gzipped or not, into dir. Only files and
+// directories are extracted, netlify has no use for links or devices.
+func extractTar(r io.Reader, dir string) error {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := archivePath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeArchiveFile(target, archive); err != nil {
+				return err
+			}
+		default:
+			log.Printf("[DEBUG] Skipping %s, only files and directories are deployed", header.Name)
+		}
+	}
+}
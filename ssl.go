@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var sslCommand = &cli.Command{
+	Name:  "ssl",
+	Usage: "manage the https certificate of a site",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "provision",
+			Usage:  "provision a certificate and wait until it is issued",
+			Action: provisionSSL,
+			Flags: []cli.Flag{
+				&cli.PathFlag{
+					Name:  "cert",
+					Usage: "PEM certificate to upload instead of using Let's Encrypt",
+				},
+				&cli.PathFlag{
+					Name:  "key",
+					Usage: "PEM private key for --cert",
+				},
+				&cli.PathFlag{
+					Name:  "ca-cert",
+					Usage: "PEM intermediate certificates for --cert",
+				},
+				&cli.DurationFlag{
+					Name:  "timeout",
+					Usage: "How long to wait for the certificate to be issued",
+					Value: 10 * time.Minute,
+				},
+			},
+		},
+		{
+			Name:   "status",
+			Usage:  "show the certificate of the site",
+			Action: sslStatus,
+		},
+	},
+}
+
+func (cfg *config) siteCertificate(siteID string) (*netlify.SniCertificate, error) {
+	cert, err := cfg.netlifyClient().Operations.ShowSiteTLSCertificate(
+		operations.NewShowSiteTLSCertificateParams().WithTimeout(cfg.APITimeout).WithSiteID(siteID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return nil, errors.Wrap(classifyAPIError(err), "Unable to get certificate")
+	}
+
+	return cert.GetPayload(), nil
+}
+
+func printCertificate(cert *netlify.SniCertificate) {
+	fmt.Printf("state:\t%s\n", cert.State)
+	fmt.Printf("domains:\t%s\n", strings.Join(cert.Domains, ", "))
+	fmt.Printf("expires:\t%s\n", cert.ExpiresAt)
+}
+
+func readOptionalFile(filename string) (*string, error) {
+	if filename == "" {
+		return nil, nil
+	}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	str := string(contents)
+	return &str, nil
+}
+
+func provisionSSL(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	certificate, err := readOptionalFile(c.Path("cert"))
+	if err != nil {
+		return errors.Wrap(err, "Unable to read certificate")
+	}
+
+	key, err := readOptionalFile(c.Path("key"))
+	if err != nil {
+		return errors.Wrap(err, "Unable to read key")
+	}
+
+	caCertificates, err := readOptionalFile(c.Path("ca-cert"))
+	if err != nil {
+		return errors.Wrap(err, "Unable to read ca certificates")
+	}
+
+	params := operations.NewProvisionSiteTLSCertificateParams().
+		WithTimeout(cfg.APITimeout).
+		WithSiteID(site.ID).
+		WithCertificate(certificate).
+		WithKey(key).
+		WithCaCertificates(caCertificates)
+
+	_, err = cfg.netlifyClient().Operations.ProvisionSiteTLSCertificate(params, authInfo(cfg.Token))
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to provision certificate")
+	}
+
+	log.Printf("Provisioning certificate for %s", site.Name)
+
+	deadline := cfg.clock.Now().Add(c.Duration("timeout"))
+	for {
+		cert, err := cfg.siteCertificate(site.ID)
+		if err != nil {
+			return err
+		}
+
+		if cert.State == "issued" {
+			printCertificate(cert)
+			return nil
+		}
+
+		if cfg.clock.Now().After(deadline) {
+			return fmt.Errorf("Certificate for %s is still %s after %s", site.Name, cert.State, c.Duration("timeout"))
+		}
+
+		cfg.clock.Sleep(5 * time.Second)
+	}
+}
+
+func sslStatus(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	cert, err := cfg.siteCertificate(site.ID)
+	if err != nil {
+		return err
+	}
+
+	printCertificate(cert)
+
+	return nil
+}
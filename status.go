@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+func printDeploy(deploy *netlify.Deploy) {
+	fmt.Printf("id:\t%s\n", deploy.ID)
+	fmt.Printf("state:\t%s\n", deploy.State)
+	if deploy.ErrorMessage != "" {
+		fmt.Printf("error:\t%s\n", deploy.ErrorMessage)
+	}
+	fmt.Printf("deploy url:\t%s\n", deploy.DeploySslURL)
+	fmt.Printf("site url:\t%s\n", deploy.SslURL)
+	fmt.Printf("admin url:\t%s\n", deploy.AdminURL)
+	fmt.Printf("created:\t%s\n", deploy.CreatedAt)
+	fmt.Printf("updated:\t%s\n", deploy.UpdatedAt)
+	if deploy.PublishedAt != "" {
+		fmt.Printf("published:\t%s\n", deploy.PublishedAt)
+	}
+}
+
+// deployStatus prints an existing deploy, for pipelines where the deploy was
+// created by a different job
+func deployStatus(c *cli.Context) error {
+	deployID := c.Args().First()
+	if deployID == "" {
+		return fmt.Errorf("status requires a deploy id")
+	}
+
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	if c.Bool("wait") {
+		deploy, err := cfg.getDeploy(deployID, "ready")
+		if err != nil {
+			return err
+		}
+
+		printDeploy(deploy)
+		return nil
+	}
+
+	deploy, err := cfg.netlifyClient().Operations.GetDeploy(
+		operations.NewGetDeployParams().WithTimeout(cfg.APITimeout).WithDeployID(deployID),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to get deploy")
+	}
+
+	printDeploy(deploy.GetPayload())
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// envPlaceholder only matches the braced ${VAR} form, a bare $VAR is far too
+// common in js and css to touch
+var envPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// substituteEnv replaces ${VAR} with the environment value. Unset variables
+// are left as they are so a typo is visible on the site rather than blank.
+func substituteEnv(content []byte) []byte {
+	return envPlaceholder.ReplaceAllFunc(content, func(placeholder []byte) []byte {
+		name := string(envPlaceholder.FindSubmatch(placeholder)[1])
+		if value, ok := os.LookupEnv(name); ok {
+			return []byte(value)
+		}
+
+		log.Printf("[WARN] %s is not set, leaving the placeholder", name)
+		return placeholder
+	})
+}
+
+// openForUpload opens the file to upload, rendering placeholders in memory
+// when it was hashed that way so the file on disk is untouched. The decision
+// is the one made while hashing rather than matching the glob again, by now
+// the uri may have a --path-prefix the glob was never meant to see.
+func openForUpload(realFilename string, substitute bool) (io.ReadCloser, error) {
+	f, err := os.Open(realFilename)
+	if err != nil || !substitute {
+		return f, err
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(bytes.NewReader(substituteEnv(content))), nil
+}
+
+// substituteEnvFiles rehashes the files matching globs with their placeholders
+// rendered, as that is the content netlify will get
+func substituteEnvFiles(dir string, globs []string, filenameToSha map[string]string, shaToFilename map[string][]*shaData) error {
+	if len(globs) == 0 {
+		return nil
+	}
+
+	uris := []string{}
+	for uri := range filenameToSha {
+		if matchesAnyGlob(globs, uri) {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+
+	for _, uri := range uris {
+		oldSha := filenameToSha[uri]
+		realfilename := filepath.Join(dir, uri)
+		if data := shaFile(shaToFilename, oldSha, uri); data != nil {
+			realfilename = data.realfilename
+		}
+
+		content, err := os.ReadFile(realfilename)
+		if err != nil {
+			return err
+		}
+
+		sha := fmt.Sprintf("%x", sha1.Sum(substituteEnv(content)))
+		removeShaFile(shaToFilename, oldSha, uri)
+		filenameToSha[uri] = sha
+		shaToFilename[sha] = append(shaToFilename[sha], &shaData{realfilename: realfilename, uri: uri, substitute: true})
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	netlify "github.com/netlify/open-api/go/models"
+)
+
+// maxSiteSuggestions keeps the did you mean list readable
+const maxSiteSuggestions = 5
+
+// editDistance is the levenshtein distance between a and b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = previous[j-1] + cost
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+// similarSiteNames returns the names of the sites closest to siteName, for
+// when it didn't match any site exactly
+func (cfg *config) similarSiteNames(siteName string) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	wanted := strings.ToLower(siteName)
+	threshold := len(wanted) / 3
+	if threshold < 2 {
+		threshold = 2
+	}
+
+	candidates := []candidate{}
+	err := cfg.eachSite(siteQuery{}, func(site *netlify.Site) bool {
+		name := strings.ToLower(site.Name)
+		distance := editDistance(wanted, name)
+		if distance <= threshold || strings.Contains(name, wanted) || strings.Contains(wanted, name) {
+			candidates = append(candidates, candidate{site.Name, distance})
+		}
+		return true
+	})
+	if err != nil {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+
+	names := []string{}
+	for i := 0; i < len(candidates) && i < maxSiteSuggestions; i++ {
+		names = append(names, candidates[i].name)
+	}
+
+	return names
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// summary is the table logged at the end of every deploy, the numbers to
+// look at when tuning queueSize and walkers
+func (r *deployReport) summary() string {
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+
+	status := "deployed"
+	if r.Err != nil {
+		status = "failed"
+	}
+
+	fmt.Fprintf(&b, "Deploy summary for %s (%s)\n", r.Site, status)
+	fmt.Fprintf(w, "  files scanned\t%d\n", r.FilesHashed)
+	if r.DeployID != "" {
+		fmt.Fprintf(w, "  already on netlify\t%d\n", r.FilesHashed-r.FilesRequired)
+	}
+	fmt.Fprintf(w, "  files uploaded\t%d\n", r.FilesUploaded)
+	fmt.Fprintf(w, "  bytes uploaded\t%s\n", humanBytes(r.BytesUploaded))
+	fmt.Fprintf(w, "  upload retries\t%d\n", r.Retries)
+	fmt.Fprintf(w, "  hash time\t%s\n", r.HashDuration.Round(time.Millisecond))
+	fmt.Fprintf(w, "  upload time\t%s\n", r.UploadDuration.Round(time.Millisecond))
+	fmt.Fprintf(w, "  processing time\t%s\n", r.ProcessingDuration.Round(time.Millisecond))
+	fmt.Fprintf(w, "  total time\t%s\n", r.Duration.Round(time.Millisecond))
+	if !r.RateLimitReset.IsZero() {
+		fmt.Fprintf(w, "  api requests left\t%d until %s\n", r.RateLimitRemaining, r.RateLimitReset.Format(time.Kitchen))
+	}
+	if r.DeployID != "" && r.Err == nil {
+		fmt.Fprintf(w, "  site url\t%s\n", r.SiteURL)
+		fmt.Fprintf(w, "  permalink\t%s\n", r.DeployURL)
+		if r.AliasURL != "" {
+			fmt.Fprintf(w, "  alias url\t%s\n", r.AliasURL)
+		}
+		fmt.Fprintf(w, "  admin url\t%s\n", r.AdminURL)
+	}
+	w.Flush()
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
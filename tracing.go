@@ -0,0 +1,542 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sethvargo/go-retry"
+)
+
+// tracer records the spans of one deploy and hands each to its exporter as
+// it finishes. Every span is a child of the root "deploy" span. A nil
+// tracer, used when no OTLP endpoint is configured, records nothing.
+type tracer struct {
+	mu       sync.Mutex
+	clock    clock
+	traceID  string
+	root     *span
+	open     map[*span]bool
+	resource []map[string]interface{}
+	exporter *otlpExporter
+}
+
+type span struct {
+	tracer     *tracer
+	id         string
+	parentID   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	err        error
+}
+
+// otlp span kinds
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// batch span processor defaults, from the OpenTelemetry sdk spec
+const (
+	otlpDefaultMaxQueueSize  = 2048
+	otlpDefaultMaxBatchSize  = 512
+	otlpDefaultScheduleDelay = 5 * time.Second
+	otlpDefaultTimeout       = 10 * time.Second
+)
+
+// otlpEnv reads the traces specific OTEL_EXPORTER_OTLP_TRACES_name variable,
+// falling back to the generic OTEL_EXPORTER_OTLP_name
+func otlpEnv(name string) string {
+	if value := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_" + name); value != "" {
+		return value
+	}
+
+	return os.Getenv("OTEL_EXPORTER_OTLP_" + name)
+}
+
+// otlpTracesEndpoint follows the OTEL_EXPORTER_OTLP_* environment variables.
+// The signal specific variable is used as is, the generic one gets /v1/traces.
+func otlpTracesEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+
+	return ""
+}
+
+// otlpHeaders parses OTEL_EXPORTER_OTLP_HEADERS, with
+// OTEL_EXPORTER_OTLP_TRACES_HEADERS overriding it key by key
+func otlpHeaders() http.Header {
+	headers := http.Header{}
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for key, value := range otelPairs(os.Getenv(name)) {
+			headers.Set(key, value)
+		}
+	}
+
+	return headers
+}
+
+// otelPairs parses the "key=value,key2=value2" lists, with url encoded
+// values, of OTEL_EXPORTER_OTLP_HEADERS and OTEL_RESOURCE_ATTRIBUTES
+func otelPairs(list string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(list, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		value, err := url.QueryUnescape(strings.TrimSpace(kv[1]))
+		if err != nil {
+			value = strings.TrimSpace(kv[1])
+		}
+		pairs[strings.TrimSpace(kv[0])] = value
+	}
+
+	return pairs
+}
+
+// otelDuration reads a variable holding milliseconds, as all the OTEL_*
+// timeouts and delays do
+func otelDuration(value string, fallback time.Duration) time.Duration {
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms <= 0 {
+		return fallback
+	}
+
+	return time.Duration(ms) * time.Millisecond
+}
+
+func otelInt(value string, fallback int) int {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return fallback
+	}
+
+	return n
+}
+
+// otlpResource is the service.name, service.version and any
+// OTEL_RESOURCE_ATTRIBUTES every batch is sent with
+func otlpResource() []map[string]interface{} {
+	attributes := otelPairs(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if serviceName := os.Getenv("OTEL_SERVICE_NAME"); serviceName != "" {
+		attributes["service.name"] = serviceName
+	}
+	if attributes["service.name"] == "" {
+		attributes["service.name"] = projectName
+	}
+	attributes["service.version"] = version
+
+	keys := []string{}
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	resource := []map[string]interface{}{}
+	for _, key := range keys {
+		resource = append(resource, otlpAttribute(key, attributes[key]))
+	}
+
+	return resource
+}
+
+func newTracer(clock clock, httpClient *http.Client) *tracer {
+	endpoint := otlpTracesEndpoint()
+	if endpoint == "" || strings.EqualFold(os.Getenv("OTEL_SDK_DISABLED"), "true") {
+		return nil
+	}
+
+	if exporter := os.Getenv("OTEL_TRACES_EXPORTER"); exporter == "none" {
+		return nil
+	} else if exporter != "" && exporter != "otlp" {
+		log.Printf("[WARN] OTEL_TRACES_EXPORTER is %s, but only otlp is supported", exporter)
+	}
+
+	if protocol := otlpEnv("PROTOCOL"); protocol != "" && protocol != "http/json" {
+		log.Printf("[WARN] OTEL_EXPORTER_OTLP_PROTOCOL is %s, but only http/json is supported, the collector has to accept json", protocol)
+	}
+
+	t := &tracer{clock: clock, traceID: randomHex(16), open: map[*span]bool{}, resource: otlpResource()}
+	t.exporter = newOTLPExporter(t, endpoint, httpClient)
+	t.root = &span{
+		tracer:     t,
+		id:         randomHex(8),
+		name:       "deploy",
+		kind:       spanKindInternal,
+		start:      clock.Now(),
+		attributes: map[string]interface{}{},
+	}
+
+	return t
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// start begins a span under the root deploy span
+func (t *tracer) start(name string, kind int) *span {
+	if t == nil {
+		return nil
+	}
+
+	s := &span{
+		tracer:     t,
+		id:         randomHex(8),
+		parentID:   t.root.id,
+		name:       name,
+		kind:       kind,
+		start:      t.clock.Now(),
+		attributes: map[string]interface{}{},
+	}
+
+	t.mu.Lock()
+	t.open[s] = true
+	t.mu.Unlock()
+
+	return s
+}
+
+func (s *span) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+
+	s.tracer.mu.Lock()
+	s.attributes[key] = value
+	s.tracer.mu.Unlock()
+}
+
+// finish ends the span, marking it failed when err is set, and queues it for
+// export
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+
+	s.tracer.mu.Lock()
+	s.end = s.tracer.clock.Now()
+	s.err = err
+	delete(s.tracer.open, s)
+	s.tracer.mu.Unlock()
+
+	s.tracer.exporter.enqueue(s)
+}
+
+// finish ends the root span and waits for every queued span to be exported
+func (t *tracer) finish(report *deployReport) error {
+	if t == nil {
+		return nil
+	}
+
+	t.root.setAttribute("netlify.site", report.Site)
+	t.root.setAttribute("netlify.deploy_id", report.DeployID)
+	t.root.setAttribute("netlify.files_uploaded", report.FilesUploaded)
+	t.root.setAttribute("netlify.bytes_uploaded", report.BytesUploaded)
+
+	// spans never finished, by a panic or an interrupted upload, end with
+	// the deploy
+	t.mu.Lock()
+	unfinished := []*span{}
+	for s := range t.open {
+		unfinished = append(unfinished, s)
+	}
+	t.mu.Unlock()
+	for _, s := range unfinished {
+		s.finish(nil)
+	}
+	t.root.finish(report.Err)
+
+	return t.exporter.shutdown()
+}
+
+// otlpExporter is a batch span processor and an OTLP http/json exporter.
+// Finished spans queue up, to at most OTEL_BSP_MAX_QUEUE_SIZE with any more
+// dropped, and are sent in batches of OTEL_BSP_MAX_EXPORT_BATCH_SIZE whenever
+// a batch is full or OTEL_BSP_SCHEDULE_DELAY has passed. A failed export is
+// retried with backoff for up to OTEL_EXPORTER_OTLP_TIMEOUT.
+type otlpExporter struct {
+	tracer     *tracer
+	endpoint   string
+	headers    http.Header
+	gzip       bool
+	timeout    time.Duration
+	httpClient *http.Client
+
+	maxQueueSize  int
+	maxBatchSize  int
+	scheduleDelay time.Duration
+
+	mu      sync.Mutex
+	queue   []*span
+	dropped int
+	failed  int
+	lastErr error
+
+	full    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func newOTLPExporter(t *tracer, endpoint string, httpClient *http.Client) *otlpExporter {
+	e := &otlpExporter{
+		tracer:        t,
+		endpoint:      endpoint,
+		headers:       otlpHeaders(),
+		gzip:          otlpEnv("COMPRESSION") == "gzip",
+		timeout:       otelDuration(otlpEnv("TIMEOUT"), otlpDefaultTimeout),
+		httpClient:    httpClient,
+		maxQueueSize:  otelInt(os.Getenv("OTEL_BSP_MAX_QUEUE_SIZE"), otlpDefaultMaxQueueSize),
+		maxBatchSize:  otelInt(os.Getenv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE"), otlpDefaultMaxBatchSize),
+		scheduleDelay: otelDuration(os.Getenv("OTEL_BSP_SCHEDULE_DELAY"), otlpDefaultScheduleDelay),
+		full:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	if e.maxBatchSize > e.maxQueueSize {
+		e.maxBatchSize = e.maxQueueSize
+	}
+
+	go e.run()
+
+	return e
+}
+
+func (e *otlpExporter) enqueue(s *span) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) >= e.maxQueueSize {
+		e.dropped++
+		return
+	}
+
+	e.queue = append(e.queue, s)
+	if len(e.queue) >= e.maxBatchSize {
+		select {
+		case e.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (e *otlpExporter) run() {
+	defer close(e.stopped)
+
+	timer := time.NewTimer(e.scheduleDelay)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-e.done:
+			e.exportQueued(true)
+			return
+		case <-e.full:
+			e.exportQueued(false)
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+			e.exportQueued(true)
+		}
+		timer.Reset(e.scheduleDelay)
+	}
+}
+
+// exportQueued sends the queue in batches, the last partial one only when
+// all is set
+func (e *otlpExporter) exportQueued(all bool) {
+	for {
+		e.mu.Lock()
+		n := len(e.queue)
+		if n > e.maxBatchSize {
+			n = e.maxBatchSize
+		}
+		if n == 0 || (n < e.maxBatchSize && !all) {
+			e.mu.Unlock()
+			return
+		}
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		e.mu.Unlock()
+
+		if err := e.export(batch); err != nil {
+			log.Printf("[WARN] Unable to export %d spans: %v", len(batch), err)
+
+			e.mu.Lock()
+			e.failed += len(batch)
+			e.lastErr = err
+			e.mu.Unlock()
+		}
+	}
+}
+
+// shutdown exports what is still queued and reports any spans that were
+// dropped or failed to export
+func (e *otlpExporter) shutdown() error {
+	close(e.done)
+	<-e.stopped
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.dropped > 0 {
+		log.Printf("[WARN] Dropped %d spans, more than OTEL_BSP_MAX_QUEUE_SIZE (%d) were waiting to be exported", e.dropped, e.maxQueueSize)
+	}
+
+	if e.lastErr != nil {
+		return errors.Wrapf(e.lastErr, "%d spans weren't exported", e.failed)
+	}
+
+	return nil
+}
+
+// export sends one batch, retrying while the collector is unreachable or
+// answers with one of the statuses OTLP says to retry
+func (e *otlpExporter) export(batch []*span) error {
+	body, err := json.Marshal(e.tracer.otlp(batch))
+	if err != nil {
+		return err
+	}
+
+	if e.gzip {
+		var compressed bytes.Buffer
+		zw := gzip.NewWriter(&compressed)
+		zw.Write(body)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = compressed.Bytes()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+	defer cancel()
+
+	backoff := clockBackoff(e.tracer.clock, e.timeout, retry.WithJitterPercent(20, retry.NewExponential(time.Second)))
+	return retry.Do(ctx, backoff, func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for key, values := range e.headers {
+			req.Header[key] = values
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", userAgent())
+		if e.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+
+		resp, err := e.httpClient.Do(req)
+		if err != nil {
+			return retry.RetryableError(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusBadGateway ||
+			resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout:
+			return retry.RetryableError(fmt.Errorf("otlp collector returned %s", resp.Status))
+		default:
+			return fmt.Errorf("otlp collector returned %s", resp.Status)
+		}
+	})
+}
+
+// otlp builds an ExportTraceServiceRequest for batch in its json encoding
+func (t *tracer) otlp(batch []*span) map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	spans := []map[string]interface{}{}
+	for _, s := range batch {
+		attributes := []map[string]interface{}{}
+		for key, value := range s.attributes {
+			attributes = append(attributes, otlpAttribute(key, value))
+		}
+
+		status := map[string]interface{}{"code": 1}
+		if s.err != nil {
+			status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+
+		otlpSpan := map[string]interface{}{
+			"traceId":           t.traceID,
+			"spanId":            s.id,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        attributes,
+			"status":            status,
+		}
+		if s.parentID != "" {
+			otlpSpan["parentSpanId"] = s.parentID
+		}
+
+		spans = append(spans, otlpSpan)
+	}
+
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{"attributes": t.resource},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": projectName},
+						"spans": spans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttribute(key string, value interface{}) map[string]interface{} {
+	var otlpValue map[string]interface{}
+	switch v := value.(type) {
+	case bool:
+		otlpValue = map[string]interface{}{"boolValue": v}
+	case int:
+		otlpValue = map[string]interface{}{"intValue": strconv.Itoa(v)}
+	case int64:
+		otlpValue = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	default:
+		otlpValue = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+
+	return map[string]interface{}{"key": key, "value": otlpValue}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// otlpCollector counts the spans in each export it accepts, answering the
+// first failures requests with status
+type otlpCollector struct {
+	mu       sync.Mutex
+	batches  []int
+	requests int
+	failures int
+	status   int
+}
+
+func (c *otlpCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests++
+	if c.requests <= c.failures {
+		w.WriteHeader(c.status)
+		return
+	}
+
+	var body struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []json.RawMessage
+			}
+		}
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.batches = append(c.batches, len(body.ResourceSpans[0].ScopeSpans[0].Spans))
+}
+
+func testTracer(t *testing.T, collector *otlpCollector) *tracer {
+	t.Helper()
+
+	server := httptest.NewServer(collector)
+	t.Cleanup(server.Close)
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", server.URL)
+
+	return newTracer(newFakeClock(), server.Client())
+}
+
+func TestTracerExportsInBatches(t *testing.T) {
+	t.Setenv("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", "2")
+	collector := &otlpCollector{}
+	tracer := testTracer(t, collector)
+
+	for i := 0; i < 4; i++ {
+		tracer.start("upload", spanKindClient).finish(nil)
+	}
+	// never finished, exported with the deploy
+	tracer.start("upload", spanKindClient)
+
+	if err := tracer.finish(&deployReport{}); err != nil {
+		t.Fatal(err)
+	}
+
+	total := 0
+	for _, n := range collector.batches {
+		if n > 2 {
+			t.Errorf("exported a batch of %d spans, want at most 2", n)
+		}
+		total += n
+	}
+	if total != 6 {
+		t.Errorf("exported %d spans in %v, want 6", total, collector.batches)
+	}
+}
+
+func TestTracerRetriesExport(t *testing.T) {
+	collector := &otlpCollector{failures: 2, status: http.StatusServiceUnavailable}
+	tracer := testTracer(t, collector)
+
+	tracer.start("upload", spanKindClient).finish(nil)
+	if err := tracer.finish(&deployReport{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if collector.requests != 3 || len(collector.batches) != 1 || collector.batches[0] != 2 {
+		t.Errorf("made %d requests exporting %v, want 3 exporting [2]", collector.requests, collector.batches)
+	}
+}
+
+func TestTracerDoesNotRetryRejectedExport(t *testing.T) {
+	collector := &otlpCollector{failures: 1, status: http.StatusBadRequest}
+	tracer := testTracer(t, collector)
+
+	if err := tracer.finish(&deployReport{}); err == nil {
+		t.Fatal("expected the rejected export to be reported")
+	}
+
+	if collector.requests != 1 {
+		t.Errorf("made %d requests, want 1", collector.requests)
+	}
+}
+
+func TestTracerDisabled(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318")
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+
+	if newTracer(newFakeClock(), http.DefaultClient) != nil {
+		t.Error("got a tracer with OTEL_SDK_DISABLED set")
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/go-openapi/runtime"
+	"github.com/pkg/errors"
+)
+
+// parseTLSVersion maps the --tls-min-version value to the crypto/tls constant
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+
+	return 0, fmt.Errorf("Unsupported tls version %s, expected 1.2 or 1.3", version)
+}
+
+// schemes is https only unless http was explicitly asked for. It is pinned
+// here rather than using plumbing.DefaultSchemes so a client upgrade can't
+// quietly widen it.
+func (cfg *config) schemes() []string {
+	if cfg.InsecureHTTP {
+		return []string{"http"}
+	}
+
+	return []string{"https"}
+}
+
+// loadCACert adds the certificates in a PEM file to the system's, so a tls
+// intercepting proxy can be trusted without losing the usual roots
+func loadCACert(filename string) (*x509.CertPool, error) {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read the ca certificate")
+	}
+
+	if !pool.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("No certificates found in %s", filename)
+	}
+
+	return pool, nil
+}
+
+// newHTTPClient builds the http client shared by every api call for a config
+func newHTTPClient(cfg *config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion:         cfg.TLSMinVersion,
+		RootCAs:            cfg.RootCAs,
+		InsecureSkipVerify: cfg.SkipTLSVerify,
+		Certificates:       cfg.ClientCerts,
+	}
+
+	if cfg.DisableHTTP2 {
+		// a non nil, empty TLSNextProto is how net/http is told not to upgrade
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+
+	return &http.Client{Transport: &rateLimitTransport{next: transport, rateLimit: cfg.rateLimit}}
+}
+
+// apiGet calls the api directly, for the few endpoints where the generated
+// client's models don't match what netlify actually returns.
+func (cfg *config) apiGet(path string, out interface{}) (*http.Response, error) {
+	return cfg.apiCall(http.MethodGet, path, out)
+}
+
+// apiCall is apiGet for any method, including the endpoints the generated
+// client doesn't have at all
+func (cfg *config) apiCall(method string, path string, out interface{}) (*http.Response, error) {
+	return cfg.apiSend(method, path, nil, out)
+}
+
+// apiSend is apiCall with a json body, for requests whose fields the
+// generated client's models are missing. Like the generated client, each call
+// is cancelled with cfg.ctx and given --api-timeout to finish.
+func (cfg *config) apiSend(method string, path string, payload interface{}, out interface{}) (*http.Response, error) {
+	ctx := cfg.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if cfg.APITimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.APITimeout)
+		defer cancel()
+	}
+
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, cfg.schemes()[0]+"://"+netlifyAPIHost+netlifyAPIPath+path, &body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	req.Header.Set("User-Agent", userAgent())
+	req.Header.Set("Authorization", "Bearer "+cfg.Token)
+
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp, classifyAPIError(runtime.NewAPIError(req.Method+" "+path, resp.Status, resp.StatusCode))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, errors.Wrap(err, "Unable to decode response")
+		}
+	}
+
+	return resp, nil
+}
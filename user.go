@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/netlify/open-api/go/plumbing/operations"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli/v2"
+)
+
+var whoamiCommand = &cli.Command{
+	Name:   "whoami",
+	Usage:  "show who the token belongs to and which teams it can deploy to",
+	Action: whoami,
+}
+
+// currentUser fetches the owner of the token. The spec (and so the generated
+// GetCurrentUser) says /user returns a list, but the api returns one object.
+func (cfg *config) currentUser() (*netlify.User, error) {
+	user := &netlify.User{}
+	if _, err := cfg.apiGet("/user", user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// whoami is for checking which token a pipeline really ended up with
+func whoami(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	user, err := cfg.currentUser()
+	if err != nil {
+		return errors.Wrap(err, "Unable to get the current user")
+	}
+
+	accounts, err := cfg.netlifyClient().Operations.ListAccountsForUser(
+		operations.NewListAccountsForUserParams().WithTimeout(cfg.APITimeout),
+		authInfo(cfg.Token),
+	)
+	if err != nil {
+		return errors.Wrap(classifyAPIError(err), "Unable to list teams")
+	}
+
+	fmt.Printf("name:\t%s\n", user.FullName)
+	fmt.Printf("email:\t%s\n", user.Email)
+	fmt.Printf("id:\t%s\n", user.ID)
+	for _, account := range accounts.GetPayload() {
+		fmt.Printf("team:\t%s (%s, %s)\n", account.Name, account.Slug, account.TypeName)
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"path"
+	"sort"
+	"strings"
+
+	netlify "github.com/netlify/open-api/go/models"
+	"github.com/urfave/cli/v2"
+)
+
+var verifyCommand = &cli.Command{
+	Name:   "verify",
+	Usage:  "check the published site serves the files in deployDir",
+	Action: verify,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:     "http",
+			Usage:    "Fetch files from the public site over http and compare their content",
+			Required: true,
+		},
+		&cli.IntFlag{
+			Name:  "sample",
+			Usage: "Number of random files to check, 0 for all of them",
+			Value: 20,
+		},
+		&cli.StringFlag{
+			Name:  "url",
+			Usage: "Base url to fetch from instead of the site's primary url, like a deploy permalink",
+		},
+	},
+}
+
+// unservedFiles are deployed but never served as is
+var unservedFiles = map[string]bool{
+	"/_redirects": true,
+	"/_headers":   true,
+}
+
+// mayBeProcessed reports if netlify can change uri's content after upload, so
+// a different hash isn't necessarily a broken publish. Html always can, as
+// snippets and analytics are injected into it.
+func mayBeProcessed(uri string, settings *netlify.SiteProcessingSettings) bool {
+	ext := strings.ToLower(path.Ext(uri))
+	if ext == ".html" || ext == ".htm" {
+		return true
+	}
+
+	if settings == nil || settings.Skip {
+		return false
+	}
+
+	switch ext {
+	case ".css":
+		return settings.CSS != nil && settings.CSS.Minify
+	case ".js":
+		return settings.Js != nil && settings.Js.Minify
+	case ".png", ".jpg", ".jpeg", ".gif":
+		return settings.Images != nil && settings.Images.Optimize
+	}
+
+	return false
+}
+
+// verify samples files from deployDir and checks the public site serves the
+// same content, the check an end user would do with a browser
+func verify(c *cli.Context) error {
+	cfg, err := newConfig(c)
+	if err != nil {
+		return err
+	}
+
+	site, err := cfg.requireSite()
+	if err != nil {
+		return err
+	}
+
+	baseURL := c.String("url")
+	if baseURL == "" {
+		baseURL = site.SslURL
+	}
+	if baseURL == "" {
+		baseURL = site.URL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	filenameToSha, _, err := filesInDirectory(cfg.Directory, cfg.Walkers, cfg.cache)
+	if err != nil {
+		return err
+	}
+
+	uris := []string{}
+	for uri := range filenameToSha {
+		if !unservedFiles[uri] {
+			uris = append(uris, uri)
+		}
+	}
+	sort.Strings(uris)
+
+	if sample := c.Int("sample"); sample > 0 && sample < len(uris) {
+		rand.Shuffle(len(uris), func(i, j int) { uris[i], uris[j] = uris[j], uris[i] })
+		uris = uris[:sample]
+		sort.Strings(uris)
+	}
+
+	mismatched := 0
+	for _, uri := range uris {
+		url := baseURL + uri
+
+		actual, err := cfg.fetchSha1(url)
+		if err != nil {
+			log.Printf("[ERROR] %v", err)
+			mismatched++
+			continue
+		}
+
+		switch {
+		case actual == filenameToSha[uri]:
+			log.Printf("%s matches", uri)
+		case mayBeProcessed(uri, site.ProcessingSettings):
+			log.Printf("[WARN] %s differs, expected as netlify post processes it", uri)
+		default:
+			log.Printf("[ERROR] %s differs, served %s but deployDir has %s", uri, actual, filenameToSha[uri])
+			mismatched++
+		}
+	}
+
+	if mismatched > 0 {
+		return fmt.Errorf("%d of %d files checked on %s don't match deployDir", mismatched, len(uris), baseURL)
+	}
+
+	log.Printf("All %d files checked on %s match deployDir", len(uris), baseURL)
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/urfave/cli/v2"
+)
+
+// set at build time by goreleaser, see ldflags in .goreleaser.yaml
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+// userAgent identifies this build to netlify, so support can tell which
+// release made a request
+func userAgent() string {
+	return fmt.Sprintf("netlifyGolangDeploy/%s (%s; %s/%s)", version, commit, runtime.GOOS, runtime.GOARCH)
+}
+
+func versionInfo(c *cli.Context) error {
+	fmt.Printf("%s %s\n", projectName, version)
+	fmt.Printf("commit: %s\n", commit)
+	fmt.Printf("built: %s\n", date)
+	fmt.Printf("go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	netlify "github.com/netlify/open-api/go/models"
+)
+
+// sitemapPath is where --warm-sitemap looks for the pages to warm
+const sitemapPath = "/sitemap.xml"
+
+type sitemap struct {
+	URLs []struct {
+		Loc string `xml:"loc"`
+	} `xml:"url"`
+}
+
+// sitemapPaths returns the path of every page in the deploy's sitemap.xml.
+// Sitemap indexes aren't followed.
+func sitemapPaths(filename string) ([]string, error) {
+	contents, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed := sitemap{}
+	if err := xml.Unmarshal(contents, &parsed); err != nil {
+		return nil, err
+	}
+
+	paths := []string{}
+	for _, entry := range parsed.URLs {
+		loc, err := url.Parse(strings.TrimSpace(entry.Loc))
+		if err != nil {
+			continue
+		}
+		paths = append(paths, loc.RequestURI())
+	}
+
+	return paths, nil
+}
+
+// warmPaths is every path to request after the deploy, from --warm-paths and
+// with --warm-sitemap the deploy's sitemap.xml
+func (cfg *config) warmPaths(filenameToSha map[string]string, shaToFilename map[string][]*shaData) []string {
+	paths := append([]string{}, cfg.WarmPaths...)
+
+	if cfg.WarmSitemap {
+		data := shaFile(shaToFilename, filenameToSha[sitemapPath], sitemapPath)
+		if data == nil {
+			log.Printf("[WARN] --warm-sitemap given but the deploy has no %s", sitemapPath)
+			return paths
+		}
+
+		sitemapPaths, err := sitemapPaths(data.realfilename)
+		if err != nil {
+			log.Printf("[WARN] Unable to read %s: %v", sitemapPath, err)
+			return paths
+		}
+		paths = append(paths, sitemapPaths...)
+	}
+
+	return paths
+}
+
+// warmCache requests every path from the new deploy so the CDN has them
+// cached before the traffic arrives. Failures are only logged.
+func (cfg *config) warmCache(deploy *netlify.Deploy, paths []string) {
+	if len(paths) == 0 {
+		return
+	}
+
+	baseURL := deploy.SslURL
+	if deploy.Draft || deploy.Branch != "" {
+		baseURL = deploy.DeploySslURL
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	concurrency := cfg.WarmConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	queue := make(chan string)
+	var failed int64
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for path := range queue {
+				if !strings.HasPrefix(path, "/") {
+					path = "/" + path
+				}
+
+				if err := cfg.warmPath(baseURL + path); err != nil {
+					log.Printf("[WARN] Unable to warm %s: %v", path, err)
+					atomic.AddInt64(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for _, path := range paths {
+		queue <- path
+	}
+	close(queue)
+	wg.Wait()
+
+	log.Printf("Warmed %d of %d paths on %s", int64(len(paths))-failed, len(paths), baseURL)
+}
+
+// warmPath fetches target once and throws the body away, through the same client
+// as api calls so proxies and tls settings apply
+func (cfg *config) warmPath(target string) error {
+	ctx := cfg.ctx
+	if cfg.APITimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.APITimeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent())
+
+	resp, err := cfg.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// snapshotDirectory records the size and mtime of every file under dir
+func snapshotDirectory(dir string) (map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			stamps[path] = fileStamp{size: info.Size(), modTime: info.ModTime()}
+		}
+
+		return nil
+	})
+
+	return stamps, err
+}
+
+// snapshotRoots is snapshotDirectory over every root, failing if any of them
+// is missing
+func snapshotRoots(roots []string) (map[string]fileStamp, error) {
+	stamps := map[string]fileStamp{}
+	for _, root := range roots {
+		rootStamps, err := snapshotDirectory(root)
+		if err != nil {
+			return nil, err
+		}
+
+		for path, stamp := range rootStamps {
+			stamps[path] = stamp
+		}
+	}
+
+	return stamps, nil
+}
+
+func sameSnapshot(a map[string]fileStamp, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for path, stamp := range a {
+		other, ok := b[path]
+		if !ok || other.size != stamp.size || !other.modTime.Equal(stamp.modTime) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// watchRoots is every directory a deploy reads files from
+func (cfg *config) watchRoots() []string {
+	roots := []string{}
+	for _, source := range cfg.sources() {
+		roots = append(roots, source.dir)
+	}
+
+	if cfg.OverlayDir != "" {
+		roots = append(roots, cfg.OverlayDir)
+	}
+
+	return roots
+}
+
+// changeNotifier sends on changes whenever something under its roots changes.
+// Sends never block, a change arriving while one is already pending is
+// merged into it.
+type changeNotifier struct {
+	changes chan struct{}
+	stop    func()
+}
+
+func (n *changeNotifier) notify() {
+	select {
+	case n.changes <- struct{}{}:
+	default:
+	}
+}
+
+// pollChanges notices changes by snapshotting roots every interval. It is
+// what's left when the os has no file events, and also works on network and
+// container mounts where those events never arrive.
+func pollChanges(roots []string, interval time.Duration) (*changeNotifier, error) {
+	last, err := snapshotRoots(roots)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	n := &changeNotifier{changes: make(chan struct{}, 1), stop: func() { close(done) }}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			// mid rebuild a root may be gone, which is a change too
+			current, err := snapshotRoots(roots)
+			if err != nil || !sameSnapshot(last, current) {
+				last = current
+				n.notify()
+			}
+		}
+	}()
+
+	return n, nil
+}
+
+// waitForChange blocks until something under roots changes and then stays
+// quiet for the debounce period, so a site generator rewriting hundreds of
+// files causes one deploy. Anything that changed since the before snapshot
+// counts, so edits made while deploying aren't missed. It returns false when
+// cfg.ctx is cancelled first.
+func (cfg *config) waitForChange(roots []string, before map[string]fileStamp) bool {
+	debounce := cfg.WatchDebounce
+	if debounce <= 0 {
+		debounce = time.Second
+	}
+
+	// changed is set once a change has been seen that hasn't been deployed
+	current, err := snapshotRoots(roots)
+	changed := err != nil || !sameSnapshot(before, current)
+	for {
+		notifier, err := cfg.changeNotifier(roots, debounce)
+		if err != nil {
+			// mid rebuild, the generator may have removed a directory
+			changed = true
+			if !cfg.sleepOrDone(debounce) {
+				return false
+			}
+			continue
+		}
+
+		if !changed {
+			select {
+			case <-cfg.ctx.Done():
+				notifier.stop()
+				return false
+			case <-notifier.changes:
+			}
+		}
+
+		quiet := time.NewTimer(debounce)
+		for settled := false; !settled; {
+			select {
+			case <-cfg.ctx.Done():
+				quiet.Stop()
+				notifier.stop()
+				return false
+			case <-notifier.changes:
+				if !quiet.Stop() {
+					<-quiet.C
+				}
+				quiet.Reset(debounce)
+			case <-quiet.C:
+				settled = true
+			}
+		}
+		notifier.stop()
+
+		if _, err := snapshotRoots(roots); err == nil {
+			return true
+		}
+		changed = true
+	}
+}
+
+// changeNotifier uses the os's file events, unless --watch-poll asks for
+// polling
+func (cfg *config) changeNotifier(roots []string, interval time.Duration) (*changeNotifier, error) {
+	if cfg.WatchPoll {
+		return pollChanges(roots, interval)
+	}
+
+	return notifyChanges(roots, interval)
+}
+
+// sleepOrDone waits for d, returning false if cfg.ctx is cancelled first
+func (cfg *config) sleepOrDone(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-cfg.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// watch makes a draft deploy, then another every time deployDir, any other
+// --deployDir or --overlay-dir changes. Changes come from the os's file
+// events where there are any (inotify on linux), and from polling every
+// --watch-debounce with --watch-poll or where there are none.
+func (cfg *config) watch() error {
+	cfg.Draft = true
+	if cfg.cache == nil {
+		cfg.cache = newDaemonCache()
+	}
+
+	roots := cfg.watchRoots()
+	for {
+		// a failed snapshot compares as changed, so it can be left nil
+		before, _ := snapshotRoots(roots)
+
+		report, err := cfg.deployAndReport()
+		if err != nil {
+			log.Printf("[WARN] Draft deploy failed, waiting for the next change: %v", err)
+		} else {
+			log.Printf("Draft deploy ready - %s", report.DeployURL)
+		}
+
+		log.Printf("Watching %s for changes", strings.Join(roots, ", "))
+		if !cfg.waitForChange(roots, before) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,137 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// inotifyEvents are the events that mean a file's content or the tree changed
+const inotifyEvents = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// pollFallbackWarning is only logged once, not at every wait for a change
+var pollFallbackWarning sync.Once
+
+// notifyChanges uses inotify, watching every directory under roots and each
+// new one as it is made. Without it (the watch limit is used up, or inotify
+// is unavailable in a sandbox) it falls back to polling, and says so.
+func notifyChanges(roots []string, interval time.Duration) (*changeNotifier, error) {
+	n, err := inotifyChanges(roots)
+	if err == nil {
+		return n, nil
+	}
+
+	if _, statErr := snapshotRoots(roots); statErr == nil {
+		pollFallbackWarning.Do(func() {
+			log.Printf("[WARN] File events unavailable, polling for changes every %s instead: %v", interval, err)
+		})
+	}
+	return pollChanges(roots, interval)
+}
+
+func inotifyChanges(roots []string) (*changeNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+
+	// a non blocking fd goes through the runtime poller, so Close wakes the
+	// pending Read up
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	// watch descriptors only name the directory, so remember which is which
+	// to find the path of a new directory
+	dirs := map[int32]string{}
+	for _, root := range roots {
+		if err := watchTree(fd, root, dirs); err != nil {
+			f.Close()
+			return nil, err
+		}
+	}
+
+	// Control keeps the fd from being closed, and so reused, while adding a
+	// watch after stop
+	conn, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	n := &changeNotifier{changes: make(chan struct{}, 1), stop: func() { f.Close() }}
+
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			read, err := f.Read(buf)
+			if err != nil {
+				// closed by stop
+				return
+			}
+
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= read; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameStart := offset + syscall.SizeofInotifyEvent
+				offset = nameStart + int(event.Len)
+
+				// a new directory, or one moved in, needs watching before
+				// anything written into it is missed
+				if event.Mask&syscall.IN_ISDIR != 0 && event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+					if parent, ok := dirs[event.Wd]; ok {
+						dir := filepath.Join(parent, string(trimNul(buf[nameStart:offset])))
+						conn.Control(func(fd uintptr) {
+							// it may already be gone again, which is its own event
+							watchTree(int(fd), dir, dirs)
+						})
+					}
+				}
+
+				if event.Mask&(inotifyEvents|syscall.IN_Q_OVERFLOW) != 0 {
+					n.notify()
+				}
+			}
+		}
+	}()
+
+	return n, nil
+}
+
+// watchTree adds a watch for dir and every directory under it
+func watchTree(fd int, dir string, dirs map[int32]string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			return nil
+		}
+
+		wd, err := syscall.InotifyAddWatch(fd, path, inotifyEvents)
+		if err != nil {
+			return os.NewSyscallError("inotify_add_watch", err)
+		}
+		dirs[int32(wd)] = path
+
+		return nil
+	})
+}
+
+// trimNul drops the nul padding inotify puts after a name
+func trimNul(name []byte) []byte {
+	for i, b := range name {
+		if b == 0 {
+			return name[:i]
+		}
+	}
+
+	return name
+}
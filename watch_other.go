@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "time"
+
+// notifyChanges polls, file events are only used on linux
+func notifyChanges(roots []string, interval time.Duration) (*changeNotifier, error) {
+	return pollChanges(roots, interval)
+}
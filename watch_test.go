@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestChangeNotifierNewSubdirectory(t *testing.T) {
+	for _, poll := range []bool{false, true} {
+		cfg := &config{WatchPoll: poll}
+		root := t.TempDir()
+
+		notifier, err := cfg.changeNotifier([]string{root}, 10*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := filepath.Join(root, "posts", "2020")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		// let the new directory's own events settle, so the next change can
+		// only come from the file written into it
+		time.Sleep(50 * time.Millisecond)
+		select {
+		case <-notifier.changes:
+		default:
+		}
+
+		if err := ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("hello"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-notifier.changes:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no change noticed for a file in a new directory (polling %t)", poll)
+		}
+
+		notifier.stop()
+	}
+}
+
+func TestWaitForChangeNewSubdirectory(t *testing.T) {
+	root := t.TempDir()
+	roots := []string{root}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cfg := &config{WatchDebounce: 20 * time.Millisecond, ctx: ctx}
+
+	before, err := snapshotRoots(roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		dir := filepath.Join(root, "assets", "css")
+		os.MkdirAll(dir, 0755)
+		ioutil.WriteFile(filepath.Join(dir, "site.css"), []byte("body {}"), 0644)
+	}()
+
+	if !cfg.waitForChange(roots, before) {
+		t.Fatal("gave up before noticing the change")
+	}
+
+	after, err := snapshotRoots(roots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := after[filepath.Join(root, "assets", "css", "site.css")]; !ok {
+		t.Errorf("redeployed before the new file was written: %v", after)
+	}
+}